@@ -0,0 +1,116 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io"
+  "strings"
+  "text/tabwriter"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+// catalogEntryJSON is the form of a gen.CatalogEntry that we print as JSON.
+type catalogEntryJSON struct {
+  Name string `json:"name"`
+  Path string `json:"path"`
+  Attributes interface{} `json:"attributes,omitempty"`
+  Err string `json:"error,omitempty"`
+  Shadowed []string `json:"shadowed,omitempty"`
+}
+
+func toJSONEntry(e *gen.CatalogEntry) *catalogEntryJSON {
+  j := &catalogEntryJSON{
+    Name: e.Name,
+    Path: e.Path,
+    Attributes: e.Attributes,
+    Shadowed: e.Shadowed,
+  }
+  if e.Err != nil {
+    j.Err = e.Err.Error()
+  }
+  return j
+}
+
+// list prints all of the templates in the refpaths.
+func list(o *options, w io.Writer) error {
+  catalog, err := gen.ReadCatalog(o.refpathsOrDefault())
+  if err != nil {
+    return err
+  }
+  if o.json {
+    entries := make([]*catalogEntryJSON, len(catalog))
+    for i, e := range catalog {
+      entries[i] = toJSONEntry(e)
+    }
+    return writeJSON(w, entries)
+  }
+  tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+  fmt.Fprintln(tw, "NAME\tPATH\tATTRIBUTES")
+  for _, e := range catalog {
+    if summary := attributesSummary(e); summary != "" {
+      fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Name, e.Path, summary)
+    } else {
+      fmt.Fprintf(tw, "%s\t%s\n", e.Name, e.Path)
+    }
+    for _, p := range e.Shadowed {
+      fmt.Fprintf(tw, "\t(shadows %s)\n", p)
+    }
+  }
+  return tw.Flush()
+}
+
+// show prints the details of one template.
+func show(o *options, name string, w io.Writer) error {
+  catalog, err := gen.ReadCatalog(o.refpathsOrDefault())
+  if err != nil {
+    return err
+  }
+  e := gen.FindCatalogEntry(catalog, name)
+  if e == nil {
+    return fmt.Errorf("template for %q not found", name)
+  }
+  if o.json {
+    return writeJSON(w, toJSONEntry(e))
+  }
+  fmt.Fprintf(w, "Name: %s\n", e.Name)
+  fmt.Fprintf(w, "Path: %s\n", e.Path)
+  for _, p := range e.Shadowed {
+    fmt.Fprintf(w, "Shadows: %s\n", p)
+  }
+  if e.Err != nil {
+    fmt.Fprintf(w, "Error: %v\n", e.Err)
+  }
+  if e.Attributes != nil {
+    b, err := json.MarshalIndent(e.Attributes, "", "  ")
+    if err != nil {
+      return err
+    }
+    fmt.Fprintf(w, "Attributes: %s\n", b)
+  }
+  return nil
+}
+
+// attributesSummary returns the attributes as one line of JSON, or the error.
+func attributesSummary(e *gen.CatalogEntry) string {
+  if e.Err != nil {
+    return "error: " + strings.ReplaceAll(e.Err.Error(), "\n", " ")
+  }
+  if e.Attributes == nil {
+    return ""
+  }
+  b, err := json.Marshal(e.Attributes)
+  if err != nil {
+    return "error: " + err.Error()
+  }
+  return string(b)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+  b, err := json.MarshalIndent(v, "", "  ")
+  if err != nil {
+    return err
+  }
+  _, err = fmt.Fprintf(w, "%s\n", b)
+  return err
+}
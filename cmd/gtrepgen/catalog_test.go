@@ -0,0 +1,51 @@
+package main
+
+import (
+  "strings"
+  "testing"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+func TestCatalogCommands(t *testing.T) {
+  refpathArgs := []string{"-refpath", "../../gen/testdata/catalog1", "-refpath", "../../gen/testdata/catalog2"}
+  tests := []struct{
+    basename string
+    flags []string
+    args []string
+  }{
+    {"list", nil, []string{"list"}},
+    {"list-json", []string{"-json"}, []string{"list"}},
+    {"show", nil, []string{"show", "a"}},
+    {"show-bad-json", []string{"-json"}, []string{"show", "bad"}},
+  }
+  for _, tt := range tests {
+    r := goldenbase.NewTester(tt.basename)
+    goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+    o := parseFlags(t, append(refpathArgs, tt.flags...)...)
+    var stderr strings.Builder
+    if got, want := run(o, tt.args, r.OutW, &stderr), exitOK; got != want {
+      t.Fatalf("%s: exit code got %d, want %d, stderr: %s", tt.basename, got, want, stderr.String())
+    }
+    goldenbase.FatalIfError(t, r.Assert(), "Assert")
+  }
+}
+
+func TestCatalogCommandErrors(t *testing.T) {
+  tests := []struct{
+    args []string
+    wantCode int
+  }{
+    {[]string{"show", "nosuch"}, exitFailed},
+    {[]string{"show"}, exitUsage},
+    {[]string{"list", "extra"}, exitUsage},
+    {[]string{"frobnicate"}, exitUsage},
+  }
+  for _, tt := range tests {
+    o := parseFlags(t, "-refpath", "../../gen/testdata/catalog1")
+    var stdout, stderr strings.Builder
+    if got := run(o, tt.args, &stdout, &stderr); got != tt.wantCode {
+      t.Errorf("%v: exit code got %d, want %d", tt.args, got, tt.wantCode)
+    }
+  }
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+  "fmt"
+  "io"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/dbsource"
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+// check prints the problems found in the templates in the refpaths,
+// and returns an error if any of them are errors rather than warnings.
+func check(o *options, w io.Writer) error {
+  dialect, err := o.sqlDialect()
+  if err != nil {
+    return err
+  }
+  g := gen.New("check", o.isHTML, w, &data.EmptySource{}).WithFuncs(dialect.Funcs())
+  diags, err := g.Check(o.refpathsOrDefault())
+  if err != nil {
+    return err
+  }
+  if o.dsn != "" {
+    sqlDiags, err := checkSQL(o, g, dialect)
+    if err != nil {
+      return err
+    }
+    diags = append(diags, sqlDiags...)
+    gen.SortDiagnostics(diags)
+  }
+  errorCount := 0
+  for _, d := range diags {
+    if d.Severity == gen.SeverityError {
+      errorCount++
+    }
+  }
+  if o.json {
+    if diags == nil {
+      diags = []*gen.Diagnostic{}
+    }
+    if err := writeJSON(w, diags); err != nil {
+      return err
+    }
+  } else {
+    for _, d := range diags {
+      fmt.Fprintln(w, d)
+    }
+  }
+  if errorCount > 0 {
+    return fmt.Errorf("check found %d errors", errorCount)
+  }
+  return nil
+}
+
+// checkSQL validates the literal queries in the templates against the database.
+func checkSQL(o *options, g *gen.Generator, dialect *dbsource.Dialect) ([]*gen.Diagnostic, error) {
+  queries, err := g.ExtractQueries(o.refpathsOrDefault())
+  if err != nil {
+    return nil, err
+  }
+  db, err := openDB(o)
+  if err != nil {
+    return nil, err
+  }
+  defer db.Close()
+  return dbsource.ValidateDialectQueries(db, dialect, queries, o.explain), nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+  "strings"
+  "testing"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+func TestCheckCommand(t *testing.T) {
+  tests := []struct{
+    basename string
+    flags []string
+    wantCode int
+  }{
+    {"check", []string{"-refpath", "../../gen/testdata/check"}, exitFailed},
+    {"check-json", []string{"-refpath", "../../gen/testdata/check", "-json"}, exitFailed},
+    {"check-ok", []string{"-refpath", "testdata"}, exitOK},
+    {"check-sql", []string{"-refpath", "../../dbsource/testdata/validate", "-dsn", setupDb(t)}, exitFailed},
+  }
+  for _, tt := range tests {
+    r := goldenbase.NewTester(tt.basename)
+    goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+    o := parseFlags(t, tt.flags...)
+    var stderr strings.Builder
+    if got := run(o, []string{"check"}, r.OutW, &stderr); got != tt.wantCode {
+      t.Fatalf("%s: exit code got %d, want %d, stderr: %s", tt.basename, got, tt.wantCode, stderr.String())
+    }
+    goldenbase.FatalIfError(t, r.Assert(), "Assert")
+  }
+}
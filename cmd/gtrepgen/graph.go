@@ -0,0 +1,50 @@
+package main
+
+import (
+  "fmt"
+  "io"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func readGraph(o *options) (*gen.DependencyGraph, error) {
+  dialect, err := o.sqlDialect()
+  if err != nil {
+    return nil, err
+  }
+  g := gen.New("graph", o.isHTML, nil, &data.EmptySource{}).WithFuncs(dialect.Funcs())
+  return g.DependencyGraph(o.refpathsOrDefault())
+}
+
+// graph prints the include dependencies of the templates in the refpaths
+// as DOT, or as JSON with -json.
+func graph(o *options, w io.Writer) error {
+  dg, err := readGraph(o)
+  if err != nil {
+    return err
+  }
+  if o.json {
+    return dg.WriteJSON(w)
+  }
+  return dg.WriteDOT(w)
+}
+
+// dependents prints the templates that depend on the named template.
+func dependents(o *options, name string, w io.Writer) error {
+  dg, err := readGraph(o)
+  if err != nil {
+    return err
+  }
+  if dg.Node(name) == nil {
+    return fmt.Errorf("template for %q not found", name)
+  }
+  names := dg.Dependents(name)
+  if o.json {
+    return writeJSON(w, names)
+  }
+  for _, n := range names {
+    fmt.Fprintln(w, n)
+  }
+  return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+  "strings"
+  "testing"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+func TestGraphCommands(t *testing.T) {
+  tests := []struct{
+    basename string
+    flags []string
+    args []string
+  }{
+    {"graph", nil, []string{"graph"}},
+    {"dependents", nil, []string{"dependents", "logo"}},
+  }
+  for _, tt := range tests {
+    r := goldenbase.NewTester(tt.basename)
+    goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+    o := parseFlags(t, append([]string{"-refpath", "../../gen/testdata/graph"}, tt.flags...)...)
+    var stderr strings.Builder
+    if got, want := run(o, tt.args, r.OutW, &stderr), exitOK; got != want {
+      t.Fatalf("%s: exit code got %d, want %d, stderr: %s", tt.basename, got, want, stderr.String())
+    }
+    goldenbase.FatalIfError(t, r.Assert(), "Assert")
+  }
+}
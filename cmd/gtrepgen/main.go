@@ -0,0 +1,364 @@
+// Command gtrepgen generates a report from a template in a set of reference
+// directories, optionally using data from a database.
+//
+// Usage:
+//
+//   gtrepgen -template name [-refpath dir]... [-html] [-o outfile]
+//       [-driver sqlite3 [-dialect name] -dsn dsn [-cache] [-stream] [-tx [-isolation level]]
+//       [-allow-writes] [-tables table,...]]
+//       [-params file.json] [-param name=value]...
+//       [-stats stats.json] [-stats-appendix]
+//   gtrepgen [-refpath dir]... [-json] list
+//   gtrepgen [-refpath dir]... [-json] show name
+//   gtrepgen [-refpath dir]... [-json] [-driver sqlite3 -dsn dsn [-explain]] check
+//   gtrepgen [-refpath dir]... [-json] graph
+//   gtrepgen [-refpath dir]... [-json] dependents name
+//
+// Params from -param flags override those from the -params file.
+// The params are passed to the template as a map, and are checked against
+// the params declared in the GT attributes of the template.
+//
+// Queries are written with ? or named placeholders, which are rewritten for
+// the SQL dialect of the database: sqlite, postgres, mysql or sqlserver.
+// The dialect is found from -driver unless set with -dialect. Templates can
+// use the functions sqlIdent, sqlLimit, sqlBool and sqlDate to write the
+// parts of a query that differ between dialects.
+//
+// Only SELECT and WITH queries are allowed unless -allow-writes is set.
+// With -tables, queries may use only the listed tables. A template may
+// also list the only tables that its queries, and those of the templates
+// it includes, may use, with a "tables" array in its GT attributes.
+//
+// With -tx, all of the queries of the report, including those of included
+// templates, are run in one read-only transaction, so that the report sees
+// a consistent snapshot of the database.
+//
+// The list command prints the name, path and attributes of every template
+// in the refpaths, and the show command prints the details of one template.
+// A template hidden by one with the same name in an earlier refpath is
+// reported as shadowed.
+//
+// The check command parses every template in the refpaths and prints the
+// problems it finds, such as syntax errors, includes of templates that don't
+// exist, and named args that don't match the params of the included template.
+// If -dsn is set, check also prepares each literal query passed to row or
+// rows, and each named query from a .sql file passed to query or queryRow,
+// against the database, and reports queries that fail, such as for an
+// unknown column, or that have the wrong number of args for their placeholders.
+// It exits with code 1 if it finds any errors; warnings alone don't fail.
+//
+// The graph command prints the include dependencies between the templates
+// in the refpaths in the DOT language of graphviz, or as JSON with -json.
+// The dependents command prints the templates that include the named
+// template, directly or indirectly.
+//
+// The exit code is 0 on success, 1 if the report fails, and 2 for usage errors.
+package main
+
+import (
+  "bufio"
+  "database/sql"
+  "encoding/json"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/dbsource"
+  "github.com/jimmc/gtrepgen/gen"
+
+  _ "github.com/mattn/go-sqlite3"       // driver name: sqlite3
+)
+
+const (
+  exitOK = 0
+  exitFailed = 1
+  exitUsage = 2
+)
+
+// stringList is a flag.Value that collects the values of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string {
+  return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+  *s = append(*s, v)
+  return nil
+}
+
+// options holds the values of our command line flags.
+type options struct {
+  template string
+  refpaths stringList
+  isHTML bool
+  outfile string
+  driver string
+  dialect string
+  dsn string
+  paramsFile string
+  params stringList
+  strict bool
+  lenient bool
+  timezone string
+  json bool
+  explain bool
+  cache bool
+  stream bool
+  tx bool
+  isolation string
+  allowWrites bool
+  tables string
+  statsFile string
+  statsAppendix bool
+}
+
+// addFlags defines our flags in the given FlagSet and returns the options
+// that will hold their values.
+func addFlags(fs *flag.FlagSet) *options {
+  o := &options{}
+  fs.StringVar(&o.template, "template", "", "name of the template to run (required)")
+  fs.Var(&o.refpaths, "refpath", "directory in which to look for templates (repeatable, default \".\")")
+  fs.BoolVar(&o.isHTML, "html", false, "use html templates rather than text templates")
+  fs.StringVar(&o.outfile, "o", "", "output file (default stdout)")
+  fs.StringVar(&o.driver, "driver", "sqlite3", "database driver name")
+  fs.StringVar(&o.dialect, "dialect", "", "SQL dialect of the database: sqlite, postgres, mysql or sqlserver (default from -driver)")
+  fs.StringVar(&o.dsn, "dsn", "", "database data source name; if not set, no database is used")
+  fs.StringVar(&o.paramsFile, "params", "", "JSON file containing an object of report params")
+  fs.Var(&o.params, "param", "report param as name=value (repeatable)")
+  fs.BoolVar(&o.strict, "strict", false, "make missing keys and nil values errors")
+  fs.BoolVar(&o.lenient, "lenient", false, "render placeholders for failed sections")
+  fs.StringVar(&o.timezone, "tz", "", "timezone for report times, such as America/Los_Angeles")
+  fs.BoolVar(&o.stream, "stream", false, "read the rows of each rows query as the template uses them, for large results")
+  fs.BoolVar(&o.tx, "tx", false, "run all of the queries of the report in one read-only transaction")
+  fs.StringVar(&o.isolation, "isolation", "", "isolation level of the -tx transaction, such as repeatable-read or serializable")
+  fs.BoolVar(&o.allowWrites, "allow-writes", false, "allow queries other than SELECT and WITH")
+  fs.StringVar(&o.tables, "tables", "", "comma-separated list of the only tables that queries may use")
+  fs.BoolVar(&o.cache, "cache", false, "cache the results of repeated queries during the run")
+  fs.StringVar(&o.statsFile, "stats", "", "file to which to write the queries and template times of the run as JSON")
+  fs.BoolVar(&o.statsAppendix, "stats-appendix", false, "append the queries and template times to the report")
+  fs.BoolVar(&o.explain, "explain", false, "in check, also run each query with EXPLAIN")
+  fs.BoolVar(&o.json, "json", false, "print catalog, check and graph output as JSON")
+  return o
+}
+
+func main() {
+  o := addFlags(flag.CommandLine)
+  flag.Parse()
+  os.Exit(run(o, flag.Args(), os.Stdout, os.Stderr))
+}
+
+// usageError is an error in the command line args.
+type usageError struct {
+  msg string
+}
+
+func (e *usageError) Error() string {
+  return e.msg
+}
+
+// run runs the command specified by args, or the report if there are no args,
+// and returns the exit code.
+func run(o *options, args []string, stdout, stderr io.Writer) int {
+  var err error
+  switch {
+  case len(args) == 0:
+    err = generate(o, stdout)
+  case args[0] == "list" && len(args) == 1:
+    err = list(o, stdout)
+  case args[0] == "show" && len(args) == 2:
+    err = show(o, args[1], stdout)
+  case args[0] == "check" && len(args) == 1:
+    err = check(o, stdout)
+  case args[0] == "graph" && len(args) == 1:
+    err = graph(o, stdout)
+  case args[0] == "dependents" && len(args) == 2:
+    err = dependents(o, args[1], stdout)
+  default:
+    err = &usageError{fmt.Sprintf("invalid args %v", args)}
+  }
+  if err == nil {
+    return exitOK
+  }
+  fmt.Fprintf(stderr, "gtrepgen: %v\n", err)
+  var uerr *usageError
+  if errors.As(err, &uerr) {
+    return exitUsage
+  }
+  return exitFailed
+}
+
+// refpathsOrDefault returns the refpaths from the flags, or the current directory.
+func (o *options) refpathsOrDefault() []string {
+  if len(o.refpaths) == 0 {
+    return []string{"."}
+  }
+  return o.refpaths
+}
+
+// sqlDialect returns the SQL dialect set by -dialect, or else the one for -driver.
+func (o *options) sqlDialect() (*dbsource.Dialect, error) {
+  if o.dialect != "" {
+    d, err := dbsource.DialectByName(o.dialect)
+    if err != nil {
+      return nil, &usageError{fmt.Sprintf("invalid -dialect: %v", err)}
+    }
+    return d, nil
+  }
+  d, err := dbsource.DialectByName(o.driver)
+  if err != nil {
+    return nil, &usageError{fmt.Sprintf("no SQL dialect known for -driver %s, set -dialect", o.driver)}
+  }
+  return d, nil
+}
+
+// openDB opens and connects to the database specified by the options.
+func openDB(o *options) (*sql.DB, error) {
+  db, err := sql.Open(o.driver, o.dsn)
+  if err != nil {
+    return nil, fmt.Errorf("opening database: %v", err)
+  }
+  if err := db.Ping(); err != nil {
+    db.Close()
+    return nil, fmt.Errorf("connecting to database: %v", err)
+  }
+  return db, nil
+}
+
+// generate runs the report as specified by the options.
+func generate(o *options, stdout io.Writer) error {
+  if o.template == "" {
+    return &usageError{"-template is required"}
+  }
+  if o.strict && o.lenient {
+    return &usageError{"-strict and -lenient can not both be set"}
+  }
+  refpaths := o.refpathsOrDefault()
+  var location *time.Location
+  if o.timezone != "" {
+    var err error
+    if location, err = time.LoadLocation(o.timezone); err != nil {
+      return &usageError{fmt.Sprintf("invalid -tz: %v", err)}
+    }
+  }
+  params, err := readParams(o.paramsFile, o.params)
+  if err != nil {
+    return err
+  }
+  dialect, err := o.sqlDialect()
+  if err != nil {
+    return err
+  }
+  var txOpts *sql.TxOptions
+  if o.tx {
+    txOpts = &sql.TxOptions{}
+    if o.isolation != "" {
+      if txOpts.Isolation, err = dbsource.ParseIsolationLevel(o.isolation); err != nil {
+        return &usageError{fmt.Sprintf("invalid -isolation: %v", err)}
+      }
+    }
+  } else if o.isolation != "" {
+    return &usageError{"-isolation requires -tx"}
+  }
+
+  var source data.Source = &data.EmptySource{}
+  if o.dsn != "" {
+    db, err := openDB(o)
+    if err != nil {
+      return err
+    }
+    defer db.Close()
+    policy := dbsource.Policy{AllowWrites: o.allowWrites}
+    if o.tables != "" {
+      policy.Tables = []string{}
+      for _, t := range strings.Split(o.tables, ",") {
+        if t = strings.TrimSpace(t); t != "" {
+          policy.Tables = append(policy.Tables, t)
+        }
+      }
+    }
+    source = dbsource.New(db).WithStreaming(o.stream).WithDialect(dialect).WithRunTransaction(txOpts).
+        WithPolicy(policy)
+    if o.cache {
+      cs := data.NewCachingSource(source, data.CacheOptions{})
+      defer func() {
+        glog.V(1).Infof("Query cache stats: %+v", cs.Stats())
+      }()
+      source = cs
+    }
+  }
+
+  w := stdout
+  if o.outfile != "" {
+    f, err := os.Create(o.outfile)
+    if err != nil {
+      return fmt.Errorf("creating output file: %v", err)
+    }
+    defer f.Close()
+    w = f
+  }
+  bw := bufio.NewWriter(w)
+
+  var stats gen.RunStats
+  g := gen.New(o.template, o.isHTML, bw, source).
+      WithStrict(o.strict).WithLenient(o.lenient).WithLocation(location).
+      WithStatsAppendix(o.statsAppendix).WithFuncs(dialect.Funcs())
+  if o.statsFile != "" {
+    g = g.WithRunStats(&stats)
+  }
+  glog.V(1).Infof("Running template %s in %v with params %v", o.template, refpaths, params)
+  genErr := g.FromTemplate(refpaths, params)
+  if err := bw.Flush(); err != nil {
+    return fmt.Errorf("writing output: %v", err)
+  }
+  if o.statsFile != "" {
+    if err := writeStats(o.statsFile, &stats); err != nil {
+      return err
+    }
+  }
+  return genErr
+}
+
+// writeStats writes the stats for the run to a file as JSON.
+func writeStats(path string, stats *gen.RunStats) error {
+  f, err := os.Create(path)
+  if err != nil {
+    return fmt.Errorf("creating stats file: %v", err)
+  }
+  if err := stats.WriteJSON(f); err != nil {
+    f.Close()
+    return fmt.Errorf("writing stats file: %v", err)
+  }
+  return f.Close()
+}
+
+// readParams reads the params from the JSON file, if specified, then
+// adds the params from the command line.
+func readParams(paramsFile string, paramFlags []string) (map[string]interface{}, error) {
+  params := make(map[string]interface{})
+  if paramsFile != "" {
+    b, err := ioutil.ReadFile(paramsFile)
+    if err != nil {
+      return nil, fmt.Errorf("reading params file: %v", err)
+    }
+    if err := json.Unmarshal(b, &params); err != nil {
+      return nil, fmt.Errorf("parsing params file %s: %v", paramsFile, err)
+    }
+  }
+  for _, p := range paramFlags {
+    name, value, ok := strings.Cut(p, "=")
+    if !ok || name == "" {
+      return nil, &usageError{fmt.Sprintf("invalid -param %q, must be name=value", p)}
+    }
+    params[name] = value
+  }
+  return params, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+  "database/sql"
+  "flag"
+  "path"
+  "strings"
+  "testing"
+
+  goldenbase "github.com/jimmc/golden/base"
+  goldendb "github.com/jimmc/golden/db"
+)
+
+// setupDb creates a database file from our standard test data and returns its path.
+func setupDb(t *testing.T) string {
+  t.Helper()
+  dbpath := path.Join(t.TempDir(), "test.db")
+  db, err := sql.Open("sqlite3", dbpath)
+  if err != nil {
+    t.Fatalf("Opening database: %v", err)
+  }
+  defer db.Close()
+  if err := goldendb.LoadSetupFile(db, "../../dbsource/testdata/dbsourcetest.sql"); err != nil {
+    t.Fatalf("Loading database: %v", err)
+  }
+  return dbpath
+}
+
+// parseFlags parses the args into options the same way main does.
+func parseFlags(t *testing.T, args ...string) *options {
+  t.Helper()
+  fs := flag.NewFlagSet("gtrepgen", flag.ContinueOnError)
+  o := addFlags(fs)
+  if err := fs.Parse(args); err != nil {
+    t.Fatalf("Parsing flags %v: %v", args, err)
+  }
+  return o
+}
+
+func TestRunWithParams(t *testing.T) {
+  dbpath := setupDb(t)
+  tests := []struct{
+    basename string
+    args []string
+  }{
+    {"company", []string{"-param", "company=s", "-param", "limit=2"}},
+    {"company-json", []string{"-params", "testdata/params.json"}},
+    {"company", []string{"-param", "company=s", "-param", "limit=2", "-cache"}},
+    {"company", []string{"-param", "company=s", "-param", "limit=2", "-tx", "-isolation", "serializable"}},
+    {"company", []string{"-param", "company=s", "-param", "limit=2", "-tables", "company,person"}},
+    {"company", []string{"-param", "company=s", "-param", "limit=2", "-tables", " company, person,"}},
+  }
+  for _, tt := range tests {
+    r := goldenbase.NewTester(tt.basename)
+    args := append([]string{"-template", "company", "-refpath", "testdata",
+        "-dsn", dbpath, "-o", r.OutFilePath()}, tt.args...)
+    o := parseFlags(t, args...)
+    var stdout, stderr strings.Builder
+    if got, want := run(o, nil, &stdout, &stderr), exitOK; got != want {
+      t.Fatalf("%s: exit code got %d, want %d, stderr: %s", tt.basename, got, want, stderr.String())
+    }
+    goldenbase.FatalIfError(t, goldenbase.CompareOutToGolden(r.OutFilePath(), r.GoldenFilePath()), "Compare")
+  }
+}
+
+func TestRunErrors(t *testing.T) {
+  dbpath := setupDb(t)
+  tests := []struct{
+    args []string
+    wantCode int
+    wantErr string
+  }{
+    {[]string{}, exitUsage, "-template is required"},
+    {[]string{"-template", "company", "-param", "company"}, exitUsage, "must be name=value"},
+    {[]string{"-template", "nosuch"}, exitFailed, "not found"},
+    {[]string{"-template", "company"}, exitFailed, "missing required param company"},
+    {[]string{"-template", "company", "-param", "company=x", "-param", "limit=many"}, exitFailed, "param limit"},
+    {[]string{"-template", "company", "-dialect", "oracle"}, exitUsage, "unknown SQL dialect"},
+    {[]string{"-template", "company", "-param", "company=x", "-tables", "company"}, exitFailed, "table person is not allowed"},
+    {[]string{"-template", "company", "-isolation", "serializable"}, exitUsage, "-isolation requires -tx"},
+    {[]string{"-template", "company", "-tx", "-isolation", "dirty"}, exitUsage, "unknown isolation level"},
+    {[]string{"-template", "company", "-driver", "nosuch"}, exitUsage, "no SQL dialect known for -driver nosuch"},
+  }
+  for _, tt := range tests {
+    args := append([]string{"-refpath", "testdata", "-dsn", dbpath}, tt.args...)
+    o := parseFlags(t, args...)
+    var stdout, stderr strings.Builder
+    if got := run(o, nil, &stdout, &stderr); got != tt.wantCode {
+      t.Errorf("%v: exit code got %d, want %d", tt.args, got, tt.wantCode)
+    }
+    if got := stderr.String(); !strings.Contains(got, tt.wantErr) {
+      t.Errorf("%v: stderr %q should contain %q", tt.args, got, tt.wantErr)
+    }
+  }
+}
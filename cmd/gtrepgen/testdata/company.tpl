@@ -0,0 +1,12 @@
+{{/*GT: {
+  "display": "People in a company",
+  "params": [
+    {"name": "company", "type": "string", "required": true},
+    {"name": "limit", "type": "int", "default": 10}
+  ]
+} */ -}}
+{{with row "select name from company where id = ?" .company -}}
+Company: {{.Col.name}}
+{{end -}}
+{{range rows "select firstname, lastname from person where companyid = ? order by id limit ?" .company .limit}}  {{.Col.firstname}} {{.Col.lastname}}
+{{end -}}
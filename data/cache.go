@@ -0,0 +1,210 @@
+package data
+
+import (
+  "container/list"
+  "fmt"
+  "reflect"
+  "strings"
+  "sync"
+)
+
+// noCache is the type of NoCache.
+type noCache struct{}
+
+// NoCache may be passed as the first arg to Row or Rows, before the query,
+// to ask a CachingSource not to use its cache for that call. In templates
+// it is available as the noCache function, as in {{rows noCache "select ..."}}.
+// A Generator passes it on only to a CachingSource; other Sources that may
+// be given it directly should remove it with StripNoCache.
+var NoCache = noCache{}
+
+// StripNoCache removes NoCache from the front of args, and returns the
+// remaining args and whether NoCache was present.
+func StripNoCache(args []interface{}) ([]interface{}, bool) {
+  if len(args) > 0 {
+    if _, ok := args[0].(noCache); ok {
+      return args[1:], true
+    }
+  }
+  return args, false
+}
+
+// CacheOptions are the limits for a CachingSource. Zero means no limit.
+type CacheOptions struct {
+  MaxEntries int         // The most results to keep; the least recently used are evicted.
+  MaxRows int            // Results from Rows with more rows than this are not kept.
+}
+
+// CacheStats counts the calls to a CachingSource.
+type CacheStats struct {
+  Hits int
+  Misses int
+  Uncached int           // Calls with NoCache, or with args we can't use as a key.
+  Evictions int
+}
+
+// CachingSource is a Source that remembers the results of calls to Row and
+// Rows on another Source, so that repeating the same query with the same
+// args does not query the database again. It is meant to be used for the
+// duration of one report run, so that the report sees consistent data.
+// A Generator gets a new cache for each run from BeginRun; other callers
+// should create a new one, or call Reset, for each run.
+// Errors are not cached. Cached results are shared between callers, so they
+// must not be modified. A CachingSource is safe for concurrent use.
+type CachingSource struct {
+  source Source
+  opts CacheOptions
+
+  mu sync.Mutex
+  entries map[string]*list.Element
+  lru *list.List        // Of *cacheEntry, most recently used at the front.
+  stats CacheStats
+}
+
+type cacheEntry struct {
+  key string
+  value interface{}
+}
+
+// NewCachingSource creates a CachingSource that caches calls to source.
+func NewCachingSource(source Source, opts CacheOptions) *CachingSource {
+  return &CachingSource{
+    source: source,
+    opts: opts,
+    entries: make(map[string]*list.Element),
+    lru: list.New(),
+  }
+}
+
+// Row returns the cached result of source.Row with the same args, or calls it.
+func (s *CachingSource) Row(args ...interface{}) (interface{}, error) {
+  return s.call("row", s.source.Row, args)
+}
+
+// Rows returns the cached result of source.Rows with the same args, or calls it.
+func (s *CachingSource) Rows(args ...interface{}) (interface{}, error) {
+  return s.call("rows", s.source.Rows, args)
+}
+
+// Stats returns the counts of calls since the source was created or Reset.
+func (s *CachingSource) Stats() CacheStats {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.stats
+}
+
+// BeginRun implements RunSource. Each run gets its own cache, so that
+// results are kept only for the duration of the run. If the source is a
+// RunSource, the cache is of the source it returns for the run, so that all
+// of the results come from that source, such as from its transaction.
+// The stats of the run are added to those of s at the end of the run.
+func (s *CachingSource) BeginRun() (Source, func(err error) error, error) {
+  source := s.source
+  end := func(err error) error { return nil }
+  if rs, ok := s.source.(RunSource); ok {
+    var err error
+    source, end, err = rs.BeginRun()
+    if err != nil {
+      return nil, nil, err
+    }
+  }
+  run := NewCachingSource(source, s.opts)
+  return run, func(runErr error) error {
+    stats := run.Stats()
+    s.mu.Lock()
+    s.stats.Hits += stats.Hits
+    s.stats.Misses += stats.Misses
+    s.stats.Uncached += stats.Uncached
+    s.stats.Evictions += stats.Evictions
+    s.mu.Unlock()
+    return end(runErr)
+  }, nil
+}
+
+// CheckTables implements TableChecker by asking the source, and returns an
+// error if the source is not a TableChecker. A CachingSource must check the
+// tables of a query even when its result is cached, as the result may have
+// been cached for a template that is allowed to use more tables.
+func (s *CachingSource) CheckTables(tables []string, args ...interface{}) error {
+  tc, ok := s.source.(TableChecker)
+  if !ok {
+    return fmt.Errorf("can't check the tables of queries to a %T", s.source)
+  }
+  return tc.CheckTables(tables, args...)
+}
+
+// Reset discards all cached results and clears the stats.
+func (s *CachingSource) Reset() {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.entries = make(map[string]*list.Element)
+  s.lru.Init()
+  s.stats = CacheStats{}
+}
+
+func (s *CachingSource) call(fname string, f func(args ...interface{}) (interface{}, error), args []interface{}) (interface{}, error) {
+  args, skip := StripNoCache(args)
+  key, ok := cacheKey(fname, args)
+  if skip || !ok {
+    s.mu.Lock()
+    s.stats.Uncached++
+    s.mu.Unlock()
+    return f(args...)
+  }
+  s.mu.Lock()
+  if e, ok := s.entries[key]; ok {
+    s.lru.MoveToFront(e)
+    s.stats.Hits++
+    s.mu.Unlock()
+    return e.Value.(*cacheEntry).value, nil
+  }
+  s.stats.Misses++
+  s.mu.Unlock()
+
+  // We don't hold the lock while querying, so two callers may both miss
+  // on the same key; the second result replaces the first.
+  value, err := f(args...)
+  if err != nil {
+    return nil, err
+  }
+  if _, ok := value.(*RowStream); ok {
+    return value, nil   // A stream can only be read once.
+  }
+  if s.opts.MaxRows > 0 {
+    if v := reflect.ValueOf(value); v.Kind() == reflect.Slice && v.Len() > s.opts.MaxRows {
+      return value, nil
+    }
+  }
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if e, ok := s.entries[key]; ok {
+    e.Value.(*cacheEntry).value = value
+    s.lru.MoveToFront(e)
+    return value, nil
+  }
+  s.entries[key] = s.lru.PushFront(&cacheEntry{key: key, value: value})
+  for s.opts.MaxEntries > 0 && s.lru.Len() > s.opts.MaxEntries {
+    oldest := s.lru.Back()
+    s.lru.Remove(oldest)
+    delete(s.entries, oldest.Value.(*cacheEntry).key)
+    s.stats.Evictions++
+  }
+  return value, nil
+}
+
+// cacheKey returns a string that identifies a call, and false if one of
+// the args is of a type that we can't safely compare by its printed value.
+func cacheKey(fname string, args []interface{}) (string, bool) {
+  var b strings.Builder
+  b.WriteString(fname)
+  for _, arg := range args {
+    switch reflect.ValueOf(arg).Kind() {
+    case reflect.Ptr, reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Interface:
+      return "", false
+    }
+    // %#v includes the type, so that 1 and "1" are different keys,
+    // and prints maps in key order.
+    fmt.Fprintf(&b, "\x00%#v", arg)
+  }
+  return b.String(), true
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+  "errors"
+  "testing"
+)
+
+// countingSource returns its call count, and fails for the query "fail".
+type countingSource struct {
+  calls int
+}
+
+func (s *countingSource) Row(args ...interface{}) (interface{}, error) {
+  s.calls++
+  if args[0] == "fail" {
+    return nil, errors.New("failed")
+  }
+  return s.calls, nil
+}
+
+func (s *countingSource) Rows(args ...interface{}) (interface{}, error) {
+  s.calls++
+  return make([]int, s.calls), nil
+}
+
+func TestCachingSource(t *testing.T) {
+  src := &countingSource{}
+  s := NewCachingSource(src, CacheOptions{})
+  first, _ := s.Row("q", 1)
+  if again, _ := s.Row("q", 1); again != first {
+    t.Errorf("Row with same args: got %v, want cached %v", again, first)
+  }
+  if other, _ := s.Row("q", "1"); other == first {
+    t.Errorf("Row with different arg type: got cached %v", other)
+  }
+  if rows, _ := s.Rows("q", 1); rows == first {
+    t.Errorf("Rows with same args as Row: got cached Row result")
+  }
+  if nocache, _ := s.Row(NoCache, "q", 1); nocache == first {
+    t.Errorf("Row with NoCache: got cached %v", nocache)
+  }
+  for i := 0; i < 2; i++ {
+    if _, err := s.Row("fail"); err == nil {
+      t.Errorf("Row fail: expected error")
+    }
+  }
+  want := CacheStats{Hits: 1, Misses: 5, Uncached: 1}
+  if got := s.Stats(); got != want {
+    t.Errorf("Stats: got %+v, want %+v", got, want)
+  }
+  if got, want := src.calls, 6; got != want {
+    t.Errorf("calls to source: got %d, want %d", got, want)
+  }
+  s.Reset()
+  if again, _ := s.Row("q", 1); again == first {
+    t.Errorf("Row after Reset: got cached %v", again)
+  }
+}
+
+func TestCachingSourceLimits(t *testing.T) {
+  src := &countingSource{}
+  s := NewCachingSource(src, CacheOptions{MaxEntries: 2, MaxRows: 3})
+  s.Row("a")
+  s.Row("b")
+  s.Row("a")            // Now b is least recently used.
+  s.Row("c")            // Evicts b.
+  s.Row("a")
+  s.Row("b")
+  if got, want := src.calls, 4; got != want {
+    t.Errorf("calls to source with MaxEntries: got %d, want %d", got, want)
+  }
+  if got, want := s.Stats().Evictions, 2; got != want {
+    t.Errorf("Evictions: got %d, want %d", got, want)
+  }
+  s.Rows("big")         // Returns 5 rows, which is more than MaxRows.
+  s.Rows("big")
+  if got, want := src.calls, 6; got != want {
+    t.Errorf("calls to source with MaxRows: got %d, want %d", got, want)
+  }
+}
+
+func TestCachingSourceBeginRun(t *testing.T) {
+  src := &countingSource{}
+  s := NewCachingSource(src, CacheOptions{})
+  for run := 1; run <= 2; run++ {
+    rs, end, err := s.BeginRun()
+    if err != nil {
+      t.Fatalf("BeginRun: %v", err)
+    }
+    first, _ := rs.Row("q")
+    if again, _ := rs.Row("q"); again != first {
+      t.Errorf("Run %d: Row with same args: got %v, want cached %v", run, again, first)
+    }
+    if err := end(nil); err != nil {
+      t.Fatalf("End of run: %v", err)
+    }
+    // Each run has its own cache, so the second run queries the source again.
+    if got, want := src.calls, run; got != want {
+      t.Errorf("Run %d: calls to source: got %d, want %d", run, got, want)
+    }
+  }
+  if got, want := s.Stats(), (CacheStats{Hits: 2, Misses: 2}); got != want {
+    t.Errorf("Stats: got %+v, want %+v", got, want)
+  }
+}
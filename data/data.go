@@ -5,6 +5,22 @@ type Source interface {
   Rows(args ...interface{}) (interface{}, error)
 }
 
+// RunSource is a Source that is set up for each report run, such as one that
+// runs all of the queries of the run in a single transaction.
+// BeginRun returns the Source to use for the run, and a function to call
+// at the end of the run with the error of the run, or nil if it succeeded,
+// which returns any error from finishing the run.
+type RunSource interface {
+  Source
+  BeginRun() (Source, func(err error) error, error)
+}
+
+// TableChecker is a Source that can check, without running it, that the
+// query in the args for Row or Rows uses only the given tables.
+type TableChecker interface {
+  CheckTables(tables []string, args ...interface{}) error
+}
+
 type EmptySource struct{}
 
 func (s *EmptySource) Row(args ...interface{}) (interface{}, error) {
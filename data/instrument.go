@@ -0,0 +1,92 @@
+package data
+
+import (
+  "reflect"
+  "time"
+)
+
+// QueryStat records one call to Row or Rows on a Source. For a call that
+// returns a RowStream, it is recorded when the stream finishes or is closed.
+type QueryStat struct {
+  Func string `json:"func"`                 // row or rows.
+  Query string `json:"query"`
+  Args []interface{} `json:"args,omitempty"`
+  Start time.Time `json:"start"`
+  Duration time.Duration `json:"duration"` // In nanoseconds in JSON.
+  Rows int `json:"rows"`                    // The number of rows returned or streamed; 1 for a successful Row.
+  Err string `json:"error,omitempty"`
+}
+
+// InstrumentedSource is a Source that measures each call to another Source
+// and passes the measurements to a function.
+type InstrumentedSource struct {
+  source Source
+  record func(*QueryStat)
+  // Now is the clock used to time the calls. It defaults to time.Now.
+  Now func() time.Time
+}
+
+// NewInstrumentedSource creates an InstrumentedSource that calls record
+// after each call to source.
+func NewInstrumentedSource(source Source, record func(*QueryStat)) *InstrumentedSource {
+  return &InstrumentedSource{
+    source: source,
+    record: record,
+    Now: time.Now,
+  }
+}
+
+// Row calls Row on our source and records it.
+func (s *InstrumentedSource) Row(args ...interface{}) (interface{}, error) {
+  return s.call("row", s.source.Row, args)
+}
+
+// Rows calls Rows on our source and records it.
+func (s *InstrumentedSource) Rows(args ...interface{}) (interface{}, error) {
+  return s.call("rows", s.source.Rows, args)
+}
+
+func (s *InstrumentedSource) call(fname string, f func(args ...interface{}) (interface{}, error), args []interface{}) (interface{}, error) {
+  qs := &QueryStat{Func: fname}
+  queryArgs, _ := StripNoCache(args)
+  if len(queryArgs) > 0 {
+    qs.Query, _ = queryArgs[0].(string)
+    qs.Args = queryArgs[1:]
+  }
+  qs.Start = s.Now()
+  v, err := f(args...)
+  if rs, ok := v.(*RowStream); ok && err == nil {
+    return s.counted(qs, rs), nil
+  }
+  qs.Duration = s.Now().Sub(qs.Start)
+  if err != nil {
+    qs.Err = err.Error()
+  } else if fname == "row" {
+    qs.Rows = 1
+  } else if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+    qs.Rows = rv.Len()
+  }
+  s.record(qs)
+  return v, err
+}
+
+// counted returns a stream that delivers the rows of rs and counts them,
+// and records qs when the stream finishes or is closed, so that the
+// duration covers reading all of the rows that were used.
+func (s *InstrumentedSource) counted(qs *QueryStat, rs *RowStream) *RowStream {
+  return NewRowStream(func(send func(*Row) bool) error {
+    for row := range rs.C {
+      if !send(row) {
+        break
+      }
+      qs.Rows++
+    }
+    err := rs.Close()
+    qs.Duration = s.Now().Sub(qs.Start)
+    if err != nil {
+      qs.Err = err.Error()
+    }
+    s.record(qs)
+    return err
+  })
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "sort"
+)
+
+// Column describes one column of a query result.
+type Column struct {
+  Name string
+  DatabaseType string    // The type name from the driver, such as VARCHAR, or empty if not known.
+  Nullable bool
+  NullableKnown bool     // False if the driver does not report whether the column is nullable.
+}
+
+// RowMeta holds information about the position of a row in its result.
+type RowMeta struct {
+  Index int              // The index of the row in the result, starting at 0.
+  Count int              // The number of rows in the result, or -1 if not known, as when streaming.
+  First bool
+  Last bool
+}
+
+// Row is one row of a query result. Col maps the name of each column to its
+// value, so that a template can use {{.Col.name}} to get the value of a
+// column, and can range over .Col or take its len to see just the columns.
+// A Row created by NewRow also keeps the order and types of its columns and
+// its position in its result, which are available in templates as
+// {{.Columns}}, {{.Values}} and {{.Meta.Index}}.
+// To iterate over the columns in order, range over Columns or Values
+// rather than over Col, which is in name order.
+type Row struct {
+  Col map[string]interface{}
+  columns []*Column
+  values []interface{}
+  meta RowMeta
+}
+
+// NewRow creates a Row with values in the order of columns.
+// The columns are not copied, so they can be shared by all of the rows of a result.
+func NewRow(columns []*Column, values []interface{}, meta RowMeta) *Row {
+  col := make(map[string]interface{}, len(columns))
+  for i, c := range columns {
+    col[c.Name] = values[i]
+  }
+  return &Row{Col: col, columns: columns, values: values, meta: meta}
+}
+
+// info returns the columns, values and metadata of the row, built from Col
+// with the columns in name order if the row was not created by NewRow.
+func (r *Row) info() ([]*Column, []interface{}, RowMeta) {
+  if r.columns != nil {
+    return r.columns, r.values, r.meta
+  }
+  var columns []*Column
+  var values []interface{}
+  for _, name := range sortedKeys(r.Col) {
+    columns = append(columns, &Column{Name: name})
+    values = append(values, r.Col[name])
+  }
+  return columns, values, RowMeta{Count: -1}
+}
+
+// Columns returns the names of the columns in order.
+func (r *Row) Columns() []string {
+  columns, _, _ := r.info()
+  names := make([]string, len(columns))
+  for i, c := range columns {
+    names[i] = c.Name
+  }
+  return names
+}
+
+// ColumnTypes returns the descriptions of the columns in order.
+func (r *Row) ColumnTypes() []*Column {
+  columns, _, _ := r.info()
+  return columns
+}
+
+// Values returns the values of the columns in order.
+func (r *Row) Values() []interface{} {
+  _, values, _ := r.info()
+  return values
+}
+
+// Meta returns the position of the row in its result.
+func (r *Row) Meta() RowMeta {
+  _, _, meta := r.info()
+  return meta
+}
+
+// String formats the row like a map, with the columns in order.
+func (r *Row) String() string {
+  var b bytes.Buffer
+  b.WriteString("map[")
+  columns, values, _ := r.info()
+  for i, c := range columns {
+    if i > 0 {
+      b.WriteString(" ")
+    }
+    fmt.Fprintf(&b, "%s:%v", c.Name, values[i])
+  }
+  b.WriteString("]")
+  return b.String()
+}
+
+// MarshalJSON writes the row as a JSON object, with the columns in order.
+func (r *Row) MarshalJSON() ([]byte, error) {
+  var b bytes.Buffer
+  b.WriteString("{")
+  columns, values, _ := r.info()
+  for i, c := range columns {
+    if i > 0 {
+      b.WriteString(",")
+    }
+    k, err := json.Marshal(c.Name)
+    if err != nil {
+      return nil, err
+    }
+    v, err := json.Marshal(values[i])
+    if err != nil {
+      return nil, err
+    }
+    b.Write(k)
+    b.WriteString(":")
+    b.Write(v)
+  }
+  b.WriteString("}")
+  return b.Bytes(), nil
+}
+
+func sortedKeys(r map[string]interface{}) []string {
+  keys := make([]string, 0, len(r))
+  for k := range r {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+  "encoding/json"
+  "strings"
+  "testing"
+  "text/template"
+)
+
+func TestRow(t *testing.T) {
+  columns := []*Column{{Name: "name"}, {Name: "Columns"}, {Name: "id"}}
+  r := NewRow(columns, []interface{}{"Sample", "c", 7}, RowMeta{Index: 1, Count: 3})
+  if got, want := strings.Join(r.Columns(), ","), "name,Columns,id"; got != want {
+    t.Errorf("Columns: got %s, want %s", got, want)
+  }
+  if got, want := r.String(), "map[name:Sample Columns:c id:7]"; got != want {
+    t.Errorf("String: got %s, want %s", got, want)
+  }
+  b, err := json.Marshal(r)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got, want := string(b), `{"name":"Sample","Columns":"c","id":7}`; got != want {
+    t.Errorf("MarshalJSON: got %s, want %s", got, want)
+  }
+
+  tpl := template.Must(template.New("row").Parse(
+      `{{.Col.name}} {{.Col.id}} {{.Col.Columns}} {{len .Columns}} {{.Meta.Index}}/{{.Meta.Count}} {{.}}`))
+  var sb strings.Builder
+  if err := tpl.Execute(&sb, r); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := sb.String(), "Sample 7 c 3 1/3 map[name:Sample Columns:c id:7]"; got != want {
+    t.Errorf("Template: got %q, want %q", got, want)
+  }
+
+  // Col holds only the columns.
+  tpl = template.Must(template.New("rowmap").Parse(`{{len .Col}} {{range $k, $v := .Col}}{{$k}}={{$v}};{{end}}`))
+  sb.Reset()
+  if err := tpl.Execute(&sb, r); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := sb.String(), "3 Columns=c;id=7;name=Sample;"; got != want {
+    t.Errorf("Template range over Col: got %q, want %q", got, want)
+  }
+
+  // A copy of a row keeps its metadata.
+  r2 := *r
+  if got, want := r2.Meta().Index, 1; got != want {
+    t.Errorf("Meta.Index of copy: got %d, want %d", got, want)
+  }
+  if got, want := strings.Join(r2.Columns(), ","), "name,Columns,id"; got != want {
+    t.Errorf("Columns of copy: got %s, want %s", got, want)
+  }
+}
+
+func TestRowFromMap(t *testing.T) {
+  r := &Row{Col: map[string]interface{}{"b": 2, "a": 1}}
+  if got, want := r.String(), "map[a:1 b:2]"; got != want {
+    t.Errorf("String: got %s, want %s", got, want)
+  }
+  if got, want := r.Meta().Count, -1; got != want {
+    t.Errorf("Meta.Count: got %d, want %d", got, want)
+  }
+}
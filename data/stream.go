@@ -0,0 +1,64 @@
+package data
+
+import (
+  "sync"
+)
+
+// RowStream delivers the rows of a query one at a time on a channel, so that
+// a large result does not need to be held in memory. A template can range
+// over the channel C. The stream must be closed when the caller is done with
+// it, whether or not all of the rows were read, to release the query.
+// A Generator passes only the channel to the template, and closes a
+// RowStream returned by row or rows when the range over it ends, or else
+// at the end of the report run.
+type RowStream struct {
+  // C delivers the rows. It is closed after the last row, or when the stream is closed.
+  C <-chan *Row
+
+  done chan struct{}
+  closeOnce sync.Once
+  mu sync.Mutex
+  err error
+  finished chan struct{}
+}
+
+// NewRowStream creates a RowStream, and starts a goroutine that calls
+// produce to deliver the rows. Produce should call send for each row and
+// stop if send returns false, which means the stream has been closed.
+// The error returned by produce is returned from Close.
+func NewRowStream(produce func(send func(*Row) bool) error) *RowStream {
+  c := make(chan *Row)
+  s := &RowStream{
+    C: c,
+    done: make(chan struct{}),
+    finished: make(chan struct{}),
+  }
+  go func() {
+    defer close(s.finished)
+    defer close(c)
+    err := produce(func(row *Row) bool {
+      select {
+      case c <- row:
+        return true
+      case <-s.done:
+        return false
+      }
+    })
+    s.mu.Lock()
+    s.err = err
+    s.mu.Unlock()
+  }()
+  return s
+}
+
+// Close stops the stream if it is not finished, waits for the producer to
+// finish, and returns any error from producing the rows.
+func (s *RowStream) Close() error {
+  s.closeOnce.Do(func() {
+    close(s.done)
+  })
+  <-s.finished
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.err
+}
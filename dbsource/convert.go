@@ -0,0 +1,243 @@
+package dbsource
+
+/* This file contains the conversion of the values read from the database
+ * before they are passed to a template. The default conversion, with a nil
+ * or zero Converter, turns []byte into string and leaves all other values,
+ * including NULL as nil, as the driver returned them.
+ */
+
+import (
+  "encoding/base64"
+  "encoding/hex"
+  "fmt"
+  "math/big"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+// NullMode specifies how NULL values are converted.
+type NullMode int
+
+const (
+  NullAsNil NullMode = iota     // NULL is nil, which prints as <nil> in a template.
+  NullAsText                    // NULL is replaced by Converter.NullText.
+  NullAsTyped                   // NULL is a nil *Null, which is false and prints as nothing.
+)
+
+// DecimalMode specifies how NUMERIC and DECIMAL values are converted.
+type DecimalMode int
+
+const (
+  DecimalAsString DecimalMode = iota    // Exact, as the text from the driver; a float from the driver is unchanged.
+  DecimalAsRat                          // Exact, as a *big.Rat.
+  DecimalAsFloat                        // As a float64, which may lose precision.
+)
+
+// BinaryMode specifies how BLOB and other binary values are converted.
+type BinaryMode int
+
+const (
+  BinaryAsString BinaryMode = iota      // As a string of the raw bytes.
+  BinaryAsBytes                         // As the []byte.
+  BinaryAsBase64                        // As a string in standard base64 encoding.
+  BinaryAsHex                           // As a string in lower case hex.
+)
+
+// ConvertFunc converts one value read from a column.
+// It is not called for NULL values.
+type ConvertFunc func(col *data.Column, v interface{}) (interface{}, error)
+
+// Null is the type of a NULL when the NullMode is NullAsTyped. A NULL is a
+// nil *Null, so that it is false in a template, as in {{if .note}}, and can
+// still be told apart by its type from a missing value, which is an untyped nil.
+// It prints as nothing, rather than as the <nil> of NullAsNil; in strict mode,
+// printing it is an error, as for nil.
+type Null struct{}
+
+// String returns "", so that a NULL prints as nothing.
+func (n *Null) String() string {
+  return ""
+}
+
+// Converter specifies how the values read from the database are converted.
+// Columns are classified by their database type name, as reported by the
+// driver, ignoring case and any size in parentheses.
+type Converter struct {
+  Null NullMode
+  NullText string        // The value of NULL for NullAsText.
+
+  // If ParseTimes is true, string values in DATE, DATETIME, TIMESTAMP and
+  // TIME columns, and in the columns named in TimeColumns, are parsed into
+  // time.Time using TimeLayouts, or DefaultTimeLayouts if that is empty.
+  // Times without a zone are taken to be in TimeLocation, or UTC if that is nil.
+  // A value that can't be parsed is an error.
+  ParseTimes bool
+  TimeColumns []string
+  TimeLayouts []string
+  TimeLocation *time.Location
+
+  Decimal DecimalMode
+  Binary BinaryMode
+
+  // Types maps an upper case database type name to a function that converts
+  // values of that type. It overrides the conversions above for that type.
+  Types map[string]ConvertFunc
+}
+
+// DefaultTimeLayouts are the layouts that a Converter uses to parse times
+// if it has no TimeLayouts. They include the formats SQLite uses.
+var DefaultTimeLayouts = []string{
+  "2006-01-02 15:04:05.999999999-07:00",
+  "2006-01-02T15:04:05.999999999-07:00",
+  "2006-01-02 15:04:05.999999999",
+  "2006-01-02T15:04:05.999999999",
+  time.RFC3339Nano,
+  "2006-01-02 15:04",
+  "2006-01-02T15:04",
+  "2006-01-02",
+  "15:04:05",
+}
+
+var (
+  timeTypes = map[string]bool{"DATE": true, "DATETIME": true, "TIMESTAMP": true, "TIMESTAMPTZ": true, "TIME": true}
+  decimalTypes = map[string]bool{"NUMERIC": true, "DECIMAL": true, "MONEY": true}
+  binaryTypes = map[string]bool{"BLOB": true, "BYTEA": true, "BINARY": true, "VARBINARY": true, "IMAGE": true, "LONGBLOB": true}
+)
+
+// WithConverter creates a copy of a source that converts values with c.
+// A nil Converter gives the default conversion.
+func (s *SqlSource) WithConverter(c *Converter) *SqlSource {
+  sc := *s
+  sc.converter = c
+  return &sc
+}
+
+// baseType returns the upper case type name of col, without any size.
+func baseType(col *data.Column) string {
+  t := strings.ToUpper(strings.TrimSpace(col.DatabaseType))
+  if i := strings.IndexByte(t, '('); i >= 0 {
+    t = strings.TrimSpace(t[:i])
+  }
+  return t
+}
+
+// convert converts one value read from col.
+func (c *Converter) convert(col *data.Column, v interface{}) (interface{}, error) {
+  if c == nil {
+    if b, ok := v.([]byte); ok {
+      return string(b), nil
+    }
+    return v, nil
+  }
+  if v == nil {
+    switch c.Null {
+    case NullAsText:
+      return c.NullText, nil
+    case NullAsTyped:
+      return (*Null)(nil), nil
+    }
+    return nil, nil
+  }
+  t := baseType(col)
+  if f := c.Types[t]; f != nil {
+    return f(col, v)
+  }
+  switch {
+  case binaryTypes[t]:
+    return c.convertBinary(v), nil
+  case decimalTypes[t]:
+    return c.convertDecimal(col, v)
+  case c.ParseTimes && (timeTypes[t] || c.isTimeColumn(col.Name)):
+    return c.convertTime(col, v)
+  }
+  if b, ok := v.([]byte); ok {
+    return string(b), nil
+  }
+  return v, nil
+}
+
+func (c *Converter) isTimeColumn(name string) bool {
+  for _, n := range c.TimeColumns {
+    if n == name {
+      return true
+    }
+  }
+  return false
+}
+
+func (c *Converter) convertBinary(v interface{}) interface{} {
+  b, ok := v.([]byte)
+  if !ok {
+    if s, isString := v.(string); isString {
+      b = []byte(s)
+    } else {
+      return v
+    }
+  }
+  switch c.Binary {
+  case BinaryAsBytes:
+    return b
+  case BinaryAsBase64:
+    return base64.StdEncoding.EncodeToString(b)
+  case BinaryAsHex:
+    return hex.EncodeToString(b)
+  }
+  return string(b)
+}
+
+func (c *Converter) convertDecimal(col *data.Column, v interface{}) (interface{}, error) {
+  if b, ok := v.([]byte); ok {
+    v = string(b)
+  }
+  switch c.Decimal {
+  case DecimalAsRat:
+    switch x := v.(type) {
+    case string:
+      r, ok := new(big.Rat).SetString(x)
+      if !ok {
+        return nil, fmt.Errorf("column %s: invalid decimal %q", col.Name, x)
+      }
+      return r, nil
+    case int64:
+      return new(big.Rat).SetInt64(x), nil
+    case float64:
+      return new(big.Rat).SetFloat64(x), nil
+    }
+  case DecimalAsFloat:
+    if s, ok := v.(string); ok {
+      f, err := strconv.ParseFloat(s, 64)
+      if err != nil {
+        return nil, fmt.Errorf("column %s: invalid decimal %q", col.Name, s)
+      }
+      return f, nil
+    }
+  }
+  return v, nil
+}
+
+func (c *Converter) convertTime(col *data.Column, v interface{}) (interface{}, error) {
+  if b, ok := v.([]byte); ok {
+    v = string(b)
+  }
+  s, ok := v.(string)
+  if !ok {
+    return v, nil       // Already a time.Time, or a number we leave alone.
+  }
+  layouts := c.TimeLayouts
+  if len(layouts) == 0 {
+    layouts = DefaultTimeLayouts
+  }
+  loc := c.TimeLocation
+  if loc == nil {
+    loc = time.UTC
+  }
+  for _, layout := range layouts {
+    if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+      return t, nil
+    }
+  }
+  return nil, fmt.Errorf("column %s: can't parse %q as a time", col.Name, s)
+}
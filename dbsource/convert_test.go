@@ -0,0 +1,125 @@
+package dbsource
+
+import (
+  "math/big"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/gen"
+
+  goldendb "github.com/jimmc/golden/db"
+)
+
+func TestConvert(t *testing.T) {
+  numeric := &data.Column{Name: "price", DatabaseType: "NUMERIC(10,2)"}
+  blob := &data.Column{Name: "data", DatabaseType: "blob"}
+  date := &data.Column{Name: "day", DatabaseType: "DATE"}
+  text := &data.Column{Name: "created", DatabaseType: "TEXT"}
+  upper := func(col *data.Column, v interface{}) (interface{}, error) {
+    return strings.ToUpper(v.(string)), nil
+  }
+  tests := []struct{
+    name string
+    c *Converter
+    col *data.Column
+    v interface{}
+    want interface{}
+  }{
+    {"default bytes", nil, text, []byte("abc"), "abc"},
+    {"default null", nil, text, nil, nil},
+    {"null text", &Converter{Null: NullAsText, NullText: "-"}, text, nil, "-"},
+    {"null typed", &Converter{Null: NullAsTyped}, text, nil, (*Null)(nil)},
+    {"decimal string", &Converter{}, numeric, []byte("12.50"), "12.50"},
+    {"decimal rat", &Converter{Decimal: DecimalAsRat}, numeric, []byte("12.50"), big.NewRat(25, 2)},
+    {"decimal rat from float", &Converter{Decimal: DecimalAsRat}, numeric, 0.5, big.NewRat(1, 2)},
+    {"decimal float", &Converter{Decimal: DecimalAsFloat}, numeric, "12.50", 12.5},
+    {"binary string", &Converter{}, blob, []byte{'h', 'i'}, "hi"},
+    {"binary bytes", &Converter{Binary: BinaryAsBytes}, blob, []byte{1, 2}, []byte{1, 2}},
+    {"binary base64", &Converter{Binary: BinaryAsBase64}, blob, []byte{1, 2, 255}, "AQL/"},
+    {"binary hex", &Converter{Binary: BinaryAsHex}, blob, []byte{1, 2, 255}, "0102ff"},
+    {"time not parsed", &Converter{}, date, "2019-02-14", "2019-02-14"},
+    {"time date", &Converter{ParseTimes: true}, date, "2019-02-14", time.Date(2019, 2, 14, 0, 0, 0, 0, time.UTC)},
+    {"time column", &Converter{ParseTimes: true, TimeColumns: []string{"created"}}, text,
+        "2019-02-14 10:30:00", time.Date(2019, 2, 14, 10, 30, 0, 0, time.UTC)},
+    {"time text column", &Converter{ParseTimes: true}, text, "2019-02-14", "2019-02-14"},
+    {"types", &Converter{Types: map[string]ConvertFunc{"TEXT": upper}}, text, "abc", "ABC"},
+  }
+  for _, tt := range tests {
+    got, err := tt.c.convert(tt.col, tt.v)
+    if err != nil {
+      t.Errorf("%s: unexpected error: %v", tt.name, err)
+      continue
+    }
+    if r, ok := tt.want.(*big.Rat); ok {
+      if gr, ok := got.(*big.Rat); !ok || gr.Cmp(r) != 0 {
+        t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+      }
+      continue
+    }
+    if t1, ok := tt.want.(time.Time); ok {
+      if gt, ok := got.(time.Time); !ok || !gt.Equal(t1) {
+        t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+      }
+      continue
+    }
+    if b, ok := tt.want.([]byte); ok {
+      if gb, ok := got.([]byte); !ok || string(gb) != string(b) {
+        t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+      }
+      continue
+    }
+    if got != tt.want {
+      t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+    }
+  }
+}
+
+func TestConvertErrors(t *testing.T) {
+  c := &Converter{ParseTimes: true, Decimal: DecimalAsRat}
+  if _, err := c.convert(&data.Column{Name: "d", DatabaseType: "DATE"}, "yesterday"); err == nil {
+    t.Errorf("invalid time: expected error")
+  }
+  if _, err := c.convert(&data.Column{Name: "n", DatabaseType: "DECIMAL"}, "1.2.3"); err == nil {
+    t.Errorf("invalid decimal: expected error")
+  }
+}
+
+func TestConverterInTemplate(t *testing.T) {
+  db, err := goldendb.DbWithSetupString(`
+    create table things(id integer, note text, created text, data blob);
+    insert into things values(1, null, '2019-02-14 10:30:00', x'0102ff');
+  `)
+  if err != nil {
+    t.Fatalf("Creating database: %v", err)
+  }
+  defer db.Close()
+  source := New(db).WithConverter(&Converter{
+    Null: NullAsText,
+    NullText: "(none)",
+    ParseTimes: true,
+    TimeColumns: []string{"created"},
+    Binary: BinaryAsHex,
+  })
+  var b strings.Builder
+  g := gen.New("convert", false, &b, source)
+  templ := `{{with row "select * from things"}}{{.Col.note}} {{.Col.created.Format "Jan 2"}} {{.Col.data}}{{end}}`
+  if err := g.FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "(none) Feb 14 0102ff"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+
+  // A typed NULL is false, and prints as nothing.
+  b.Reset()
+  g = gen.New("convert", false, &b, New(db).WithConverter(&Converter{Null: NullAsTyped}))
+  templ = `{{with row "select * from things"}}{{if .Col.note}}set{{else}}null{{end}} [{{.Col.note}}] {{printf "%T" .Col.note}}{{end}}`
+  if err := g.FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "null [] *dbsource.Null"; got != want {
+    t.Errorf("Typed null: got %q, want %q", got, want)
+  }
+}
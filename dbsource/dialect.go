@@ -0,0 +1,196 @@
+package dbsource
+
+/* This file contains the differences between the SQL of the databases we
+ * support, so that the same template queries can be run against SQLite in
+ * tests and another database in production.
+ * Queries are written with ? or named placeholders, which are rewritten to
+ * the placeholders of the dialect. For the parts of a query that can't be
+ * passed as args, such as identifiers, limits and literals, the dialect
+ * provides template functions that write them in its syntax.
+ */
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Dialect describes the SQL syntax of one kind of database.
+type Dialect struct {
+  Name string
+  placeholder string          // Format of a placeholder, with %d for its 1-based position.
+  quoteOpen, quoteClose string
+  trueLiteral, falseLiteral string
+  dateFormat string           // Format of a date literal, with %s for the quoted date.
+  offsetFetch bool            // Use OFFSET ... FETCH rather than LIMIT ... OFFSET.
+  noLimit string              // The LIMIT needed before an OFFSET when there is no limit.
+  explain string              // Prefix to explain a query, or empty if not supported.
+}
+
+// The dialects we support.
+var (
+  SQLite = &Dialect{
+    Name: "sqlite",
+    placeholder: "?",
+    quoteOpen: `"`, quoteClose: `"`,
+    trueLiteral: "1", falseLiteral: "0",
+    dateFormat: "%s",
+    noLimit: "LIMIT -1",
+    explain: "EXPLAIN ",
+  }
+  Postgres = &Dialect{
+    Name: "postgres",
+    placeholder: "$%d",
+    quoteOpen: `"`, quoteClose: `"`,
+    trueLiteral: "TRUE", falseLiteral: "FALSE",
+    dateFormat: "DATE %s",
+    explain: "EXPLAIN ",
+  }
+  MySQL = &Dialect{
+    Name: "mysql",
+    placeholder: "?",
+    quoteOpen: "`", quoteClose: "`",
+    trueLiteral: "TRUE", falseLiteral: "FALSE",
+    dateFormat: "DATE %s",
+    noLimit: "LIMIT 18446744073709551615",
+    explain: "EXPLAIN ",
+  }
+  SQLServer = &Dialect{
+    Name: "sqlserver",
+    placeholder: "@p%d",
+    quoteOpen: "[", quoteClose: "]",
+    trueLiteral: "1", falseLiteral: "0",
+    dateFormat: "CAST(%s AS DATE)",
+    offsetFetch: true,
+  }
+)
+
+// dialectNames maps the names of the dialects, and of the database/sql
+// drivers commonly used for them, to the dialects.
+var dialectNames = map[string]*Dialect{
+  "sqlite": SQLite,
+  "sqlite3": SQLite,
+  "postgres": Postgres,
+  "postgresql": Postgres,
+  "pgx": Postgres,
+  "mysql": MySQL,
+  "sqlserver": SQLServer,
+  "mssql": SQLServer,
+}
+
+// DialectByName returns the dialect with the given name, which may also
+// be the name of a driver for it, such as sqlite3, pgx or mssql.
+func DialectByName(name string) (*Dialect, error) {
+  d, ok := dialectNames[strings.ToLower(name)]
+  if !ok {
+    return nil, fmt.Errorf("unknown SQL dialect %q", name)
+  }
+  return d, nil
+}
+
+// WithDialect creates a copy of a source that rewrites the placeholders of
+// its queries for the given dialect. A source with no dialect passes its
+// queries to the database with ? placeholders, as for SQLite.
+func (s *SqlSource) WithDialect(d *Dialect) *SqlSource {
+  sc := *s
+  sc.dialect = d
+  return &sc
+}
+
+// Dialect returns the dialect of the source, which is SQLite if none is set.
+func (s *SqlSource) Dialect() *Dialect {
+  if s.dialect == nil {
+    return SQLite
+  }
+  return s.dialect
+}
+
+// Placeholder returns the placeholder for the arg at 1-based position n.
+func (d *Dialect) Placeholder(n int) string {
+  if !strings.Contains(d.placeholder, "%d") {
+    return d.placeholder
+  }
+  return fmt.Sprintf(d.placeholder, n)
+}
+
+// rewritePlaceholders rewrites each ? placeholder in query to the
+// placeholder of the dialect. Other placeholders are left as they are.
+func (d *Dialect) rewritePlaceholders(query string) string {
+  if d.placeholder == "?" {
+    return query
+  }
+  var b strings.Builder
+  last := 0
+  n := 0
+  for _, p := range findPlaceholders(query) {
+    if p.text != "?" {
+      continue
+    }
+    n++
+    b.WriteString(query[last:p.start])
+    b.WriteString(d.Placeholder(n))
+    last = p.end
+  }
+  b.WriteString(query[last:])
+  return b.String()
+}
+
+// QuoteIdentifier quotes a name, such as of a table or column, so that it
+// can be used even if it is a keyword or contains special characters.
+// A name with dots, such as schema.table, is quoted in parts.
+func (d *Dialect) QuoteIdentifier(name string) string {
+  parts := strings.Split(name, ".")
+  for i, part := range parts {
+    part = strings.ReplaceAll(part, d.quoteClose, d.quoteClose + d.quoteClose)
+    parts[i] = d.quoteOpen + part + d.quoteClose
+  }
+  return strings.Join(parts, ".")
+}
+
+// Limit returns the clause that limits the results of a query to limit rows
+// after skipping offset rows. A limit less than zero means no limit.
+// For SQL Server, the clause must follow an ORDER BY.
+func (d *Dialect) Limit(limit, offset int) string {
+  if d.offsetFetch {
+    clause := "OFFSET " + strconv.Itoa(offset) + " ROWS"
+    if limit >= 0 {
+      clause += " FETCH NEXT " + strconv.Itoa(limit) + " ROWS ONLY"
+    }
+    return clause
+  }
+  var clauses []string
+  if limit >= 0 {
+    clauses = append(clauses, "LIMIT " + strconv.Itoa(limit))
+  } else if offset > 0 && d.noLimit != "" {
+    clauses = append(clauses, d.noLimit)
+  }
+  if offset > 0 {
+    clauses = append(clauses, "OFFSET " + strconv.Itoa(offset))
+  }
+  return strings.Join(clauses, " ")
+}
+
+// Bool returns the literal for a boolean value.
+func (d *Dialect) Bool(b bool) string {
+  if b {
+    return d.trueLiteral
+  }
+  return d.falseLiteral
+}
+
+// Date returns the literal for the date of t, in the location of t.
+func (d *Dialect) Date(t time.Time) string {
+  return fmt.Sprintf(d.dateFormat, "'" + t.Format("2006-01-02") + "'")
+}
+
+// Funcs returns the template functions that write the parts of a query in
+// the syntax of the dialect, for use with gen.Generator.WithFuncs.
+func (d *Dialect) Funcs() map[string]interface{} {
+  return map[string]interface{}{
+    "sqlIdent": d.QuoteIdentifier,
+    "sqlLimit": d.Limit,
+    "sqlBool": d.Bool,
+    "sqlDate": d.Date,
+  }
+}
@@ -0,0 +1,107 @@
+package dbsource
+
+import (
+  "database/sql"
+  "errors"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/google/go-cmp/cmp"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func TestDialects(t *testing.T) {
+  date := time.Date(2019, 2, 14, 10, 30, 0, 0, time.UTC)
+  query := "select * from t where a = ? and b = '?' and c in (?, ?)"
+  tests := []struct{
+    d *Dialect
+    query string
+    ident string
+    limit string
+    limitOnly string
+    offsetOnly string
+    bool string
+    date string
+  }{
+    {SQLite, query, `"order"."x""y"`, "LIMIT 10 OFFSET 20", "LIMIT 10", "LIMIT -1 OFFSET 20", "1", "'2019-02-14'"},
+    {Postgres, "select * from t where a = $1 and b = '?' and c in ($2, $3)",
+        `"order"."x""y"`, "LIMIT 10 OFFSET 20", "LIMIT 10", "OFFSET 20", "TRUE", "DATE '2019-02-14'"},
+    {MySQL, query, "`order`.`x\"y`", "LIMIT 10 OFFSET 20", "LIMIT 10", "LIMIT 18446744073709551615 OFFSET 20",
+        "TRUE", "DATE '2019-02-14'"},
+    {SQLServer, "select * from t where a = @p1 and b = '?' and c in (@p2, @p3)",
+        `[order].[x"y]`, "OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY", "OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY",
+        "OFFSET 20 ROWS", "1", "CAST('2019-02-14' AS DATE)"},
+  }
+  for _, tt := range tests {
+    if got := tt.d.rewritePlaceholders(query); got != tt.query {
+      t.Errorf("%s placeholders: got %q, want %q", tt.d.Name, got, tt.query)
+    }
+    if got := tt.d.QuoteIdentifier(`order.x"y`); got != tt.ident {
+      t.Errorf("%s QuoteIdentifier: got %s, want %s", tt.d.Name, got, tt.ident)
+    }
+    if got := tt.d.Limit(10, 20); got != tt.limit {
+      t.Errorf("%s Limit: got %q, want %q", tt.d.Name, got, tt.limit)
+    }
+    if got := tt.d.Limit(10, 0); got != tt.limitOnly {
+      t.Errorf("%s Limit without offset: got %q, want %q", tt.d.Name, got, tt.limitOnly)
+    }
+    if got := tt.d.Limit(-1, 20); got != tt.offsetOnly {
+      t.Errorf("%s Limit without limit: got %q, want %q", tt.d.Name, got, tt.offsetOnly)
+    }
+    if got := tt.d.Bool(true); got != tt.bool {
+      t.Errorf("%s Bool: got %s, want %s", tt.d.Name, got, tt.bool)
+    }
+    if got := tt.d.Date(date); got != tt.date {
+      t.Errorf("%s Date: got %s, want %s", tt.d.Name, got, tt.date)
+    }
+  }
+  if got := SQLServer.QuoteIdentifier("a]b"); got != "[a]]b]" {
+    t.Errorf("QuoteIdentifier with close bracket: got %s", got)
+  }
+}
+
+func TestDialectByName(t *testing.T) {
+  for name, want := range map[string]*Dialect{"sqlite3": SQLite, "Postgres": Postgres, "pgx": Postgres,
+      "mysql": MySQL, "mssql": SQLServer} {
+    if got, err := DialectByName(name); err != nil || got != want {
+      t.Errorf("DialectByName(%s): got %v, %v", name, got, err)
+    }
+  }
+  if _, err := DialectByName("oracle"); err == nil {
+    t.Errorf("DialectByName(oracle): expected error")
+  }
+}
+
+// recordingDB records the queries passed to it rather than running them.
+type recordingDB struct {
+  query string
+  args []interface{}
+}
+
+func (db *recordingDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+  db.query = query
+  db.args = args
+  return nil, errors.New("not run")
+}
+
+func TestDialectQueries(t *testing.T) {
+  db := &recordingDB{}
+  source := New(db).WithDialect(Postgres)
+  templ := `{{rows (printf "select * from %s where a = :a and b in (:ids) and c = %s order by id %s" ` +
+      `(sqlIdent "user") (sqlBool true) (sqlLimit 10 0)) .}}`
+  dot := map[string]interface{}{"a": 1, "ids": []string{"x", "y"}}
+  err := gen.New("dialect", false, &strings.Builder{}, source).
+      WithFuncs(source.Dialect().Funcs()).FromString(templ, dot)
+  if err == nil || !strings.Contains(err.Error(), "not run") {
+    t.Fatalf("Expected error from recordingDB, got %v", err)
+  }
+  want := `select * from "user" where a = $1 and b in ($2, $3) and c = TRUE order by id LIMIT 10`
+  if db.query != want {
+    t.Errorf("Query: got %q, want %q", db.query, want)
+  }
+  if diff := cmp.Diff([]interface{}{1, "x", "y"}, db.args); diff != "" {
+    t.Errorf("Args (-want +got):\n%s", diff)
+  }
+}
@@ -0,0 +1,183 @@
+package dbsource
+
+/* This file contains the expansion of a slice arg bound to an IN list,
+ * as in "select * from person where id in (?)" with a []string arg.
+ * database/sql does not accept a slice as an arg, so we replace the
+ * placeholder with one placeholder for each element of the slice and pass
+ * the elements as separate args.
+ * An empty slice can't be written as an empty list, which is a syntax error
+ * in most databases, so "x in (?)" becomes "x in (NULL)", which matches
+ * no rows, and "x not in (?)" becomes "x is not null". Unlike the empty
+ * list of standard SQL, neither of these matches a row in which x is null.
+ */
+
+import (
+  "fmt"
+  "reflect"
+  "strconv"
+  "strings"
+)
+
+// listArg returns the elements of arg if it is a slice or array that
+// should be expanded, which is any but a []byte.
+func listArg(arg interface{}) ([]interface{}, bool) {
+  v := reflect.ValueOf(arg)
+  if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+    return nil, false
+  }
+  if v.Type().Elem().Kind() == reflect.Uint8 {
+    return nil, false
+  }
+  elems := make([]interface{}, v.Len())
+  for i := range elems {
+    elems[i] = v.Index(i).Interface()
+  }
+  return elems, true
+}
+
+// hasListArg returns true if any of args is a slice to be expanded.
+func hasListArg(args []interface{}) bool {
+  for _, arg := range args {
+    if _, ok := listArg(arg); ok {
+      return true
+    }
+  }
+  return false
+}
+
+// inList describes the IN list around a placeholder.
+type inList struct {
+  start, end int        // Offsets of the whole "in (?)" or "not in (?)".
+  open int              // Offset of the open parenthesis.
+  not bool
+}
+
+// findInList returns the IN list of which p is the only element, if any.
+func findInList(query string, p placeholder) (inList, bool) {
+  var in inList
+  i := skipSpaceBack(query, p.start)
+  if i == 0 || query[i-1] != '(' {
+    return in, false
+  }
+  in.open = i - 1
+  j := skipSpace(query, p.end)
+  if j == len(query) || query[j] != ')' {
+    return in, false
+  }
+  in.end = j + 1
+  wordEnd := skipSpaceBack(query, in.open)
+  if !wordBefore(query, wordEnd, "in") {
+    return in, false
+  }
+  in.start = wordEnd - 2
+  notEnd := skipSpaceBack(query, in.start)
+  if notEnd < in.start && wordBefore(query, notEnd, "not") {
+    in.start = notEnd - 3
+    in.not = true
+  }
+  return in, true
+}
+
+// wordBefore returns true if the keyword word ends at offset end in query.
+func wordBefore(query string, end int, word string) bool {
+  start := end - len(word)
+  if start < 0 || !strings.EqualFold(query[start:end], word) {
+    return false
+  }
+  return start == 0 || !isIdentChar(query[start-1])
+}
+
+func skipSpace(query string, i int) int {
+  for i < len(query) && isSpace(query[i]) {
+    i++
+  }
+  return i
+}
+
+func skipSpaceBack(query string, i int) int {
+  for i > 0 && isSpace(query[i-1]) {
+    i--
+  }
+  return i
+}
+
+func isSpace(c byte) bool {
+  return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// expandLists rewrites a query with positional placeholders so that each
+// slice arg that is the only element of an IN list is passed as separate
+// args, one per element. A ? placeholder stays ?, and a numbered
+// placeholder ($N or ?N) is renumbered in its own style, so that it works
+// with the placeholders of any of the databases we support.
+// It is an error for a slice arg to be used other than in an IN list.
+func expandLists(query string, args []interface{}) (string, []interface{}, error) {
+  var b strings.Builder
+  var expanded []interface{}
+  last := 0
+  positional := 0
+  for _, p := range findPlaceholders(query) {
+    var index int
+    prefix := p.text[:1]
+    numbered := len(p.text) > 1
+    switch {
+    case isNamedPlaceholder(p.text):
+      return "", nil, fmt.Errorf("can't expand a list for named placeholder %s", p.text)
+    case numbered:
+      k, err := strconv.Atoi(p.text[1:])
+      if err != nil || k < 1 {
+        return "", nil, fmt.Errorf("invalid placeholder %s", p.text)
+      }
+      index = k - 1
+    default:
+      index = positional
+      positional++
+    }
+    if index >= len(args) {
+      return "", nil, fmt.Errorf("no arg for placeholder %s", p.text)
+    }
+    placeholder := func() string {
+      if numbered {
+        return prefix + strconv.Itoa(len(expanded))
+      }
+      return prefix
+    }
+    elems, isList := listArg(args[index])
+    if !isList {
+      b.WriteString(query[last:p.start])
+      expanded = append(expanded, args[index])
+      b.WriteString(placeholder())
+      last = p.end
+      continue
+    }
+    in, ok := findInList(query, p)
+    if !ok {
+      return "", nil, fmt.Errorf("list arg for placeholder %s is not the only element of an IN list", p.text)
+    }
+    if len(elems) == 0 {
+      if in.not {
+        b.WriteString(query[last:in.start])
+        b.WriteString("is not null")
+      } else {
+        b.WriteString(query[last:in.open])
+        b.WriteString("(NULL)")
+      }
+      last = in.end
+      continue
+    }
+    b.WriteString(query[last:p.start])
+    for i, elem := range elems {
+      if i > 0 {
+        b.WriteString(", ")
+      }
+      expanded = append(expanded, elem)
+      b.WriteString(placeholder())
+    }
+    last = p.end
+  }
+  if positional > 0 && positional != len(args) {
+    return "", nil, fmt.Errorf("query has %d placeholders but is passed %d args", positional, len(args))
+  }
+  b.WriteString(query[last:])
+  return b.String(), expanded, nil
+}
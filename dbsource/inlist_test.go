@@ -0,0 +1,88 @@
+package dbsource
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func TestExpandLists(t *testing.T) {
+  tests := []struct{
+    name string
+    query string
+    args []interface{}
+    wantQuery string
+    wantArgs []interface{}
+  }{
+    {"question", "select * from t where a = ? and b in (?)", []interface{}{1, []string{"x", "y"}},
+        "select * from t where a = ? and b in (?, ?)", []interface{}{1, "x", "y"}},
+    {"dollar", "select * from t where b IN ( $2 ) and a = $1", []interface{}{1, []int{7, 8, 9}},
+        "select * from t where b IN ( $1, $2, $3 ) and a = $4", []interface{}{7, 8, 9, 1}},
+    {"numbered", "select * from t where b in (?1) and c = ?2", []interface{}{[2]int{7, 8}, 3},
+        "select * from t where b in (?1, ?2) and c = ?3", []interface{}{7, 8, 3}},
+    {"empty", "select * from t where b in (?) and c = ?", []interface{}{[]string{}, 3},
+        "select * from t where b in (NULL) and c = ?", []interface{}{3}},
+    {"empty not", "select * from t where b not  in(?)", []interface{}{[]interface{}{}},
+        "select * from t where b is not null", nil},
+    {"bytes", "select * from t where b in (?) and c = ?", []interface{}{[]string{"x"}, []byte("y")},
+        "select * from t where b in (?) and c = ?", []interface{}{"x", []byte("y")}},
+  }
+  for _, tt := range tests {
+    query, args, err := expandLists(tt.query, tt.args)
+    if err != nil {
+      t.Errorf("%s: unexpected error: %v", tt.name, err)
+      continue
+    }
+    if query != tt.wantQuery {
+      t.Errorf("%s: query got %q, want %q", tt.name, query, tt.wantQuery)
+    }
+    if diff := cmp.Diff(tt.wantArgs, args); diff != "" {
+      t.Errorf("%s: args (-want +got):\n%s", tt.name, diff)
+    }
+  }
+
+  errTests := []struct{
+    name string
+    query string
+    args []interface{}
+    want string
+  }{
+    {"not in list", "select * from t where b = ?", []interface{}{[]string{"x"}}, "not the only element of an IN list"},
+    {"not only element", "select * from t where b in (?, ?)", []interface{}{[]string{"x"}, "y"}, "not the only element"},
+    {"not keyword", "select * from t where join(?)", []interface{}{[]string{"x"}}, "not the only element"},
+    {"too few args", "select * from t where b in (?) and a = ?", []interface{}{[]string{"x"}}, "no arg for placeholder ?"},
+    {"too many args", "select * from t where b in (?)", []interface{}{[]string{"x"}, 2}, "1 placeholders but is passed 2 args"},
+  }
+  for _, tt := range errTests {
+    _, _, err := expandLists(tt.query, tt.args)
+    if err == nil {
+      t.Errorf("%s: expected error", tt.name)
+    } else if !strings.Contains(err.Error(), tt.want) {
+      t.Errorf("%s: got error %q, want %q", tt.name, err, tt.want)
+    }
+  }
+}
+
+func TestListArgsInTemplate(t *testing.T) {
+  db := testDb(t, ":memory:")
+  templ := `{{range rows "select id from person where id in (?) order by id" .ids}}{{.Col.id}};{{end}}` +
+      `{{range rows "select id from person where id not in (:ids) and companyid = :company order by id" .}}{{.Col.id}};{{end}}` +
+      `{{range rows "select id from person where id in (?)" .none}}{{.Col.id}};{{end}}` +
+      `{{range rows "select id from person where id not in (?) and companyid = 'x'" .none}}{{.Col.id}};{{end}}`
+  dot := map[string]interface{}{
+    "ids": []interface{}{"p1", "p3", "p4"},
+    "company": "s",
+    "none": []string{},
+  }
+  var b strings.Builder
+  source := New(db).WithUnusedNamesAllowed(true)
+  if err := gen.New("inlist", false, &b, source).FromString(templ, dot); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "p1;p3;p4;p5;p1;p2;"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+}
@@ -0,0 +1,139 @@
+package dbsource
+
+/* This file contains support for named placeholders in queries, such as
+ * "select * from person where companyid = :company", which are bound from
+ * a map passed as the only arg after the query, as in
+ * {{rows "select ... where companyid = :company" .}} where dot is the map
+ * of report params. The query is rewritten to use positional placeholders
+ * before it is passed to the database.
+ */
+
+import (
+  "fmt"
+  "reflect"
+  "sort"
+  "strings"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+// WithUnusedNamesAllowed creates a copy of a source that does or does not
+// allow the map for a query with named placeholders to have entries that
+// are not used by the query. They are not allowed by default, so that a
+// misspelled name is found; allowing them lets a template pass a map with
+// other entries, such as the report params.
+func (s *SqlSource) WithUnusedNamesAllowed(allowed bool) *SqlSource {
+  sc := *s
+  sc.allowUnusedNames = allowed
+  return &sc
+}
+
+// hasNamedPlaceholders returns true if the query uses :name or @name placeholders.
+func hasNamedPlaceholders(query string) bool {
+  for _, p := range findPlaceholders(query) {
+    if isNamedPlaceholder(p.text) {
+      return true
+    }
+  }
+  return false
+}
+
+func isNamedPlaceholder(text string) bool {
+  return text[0] == ':' || text[0] == '@'
+}
+
+// rewriteNamed rewrites a query that uses named placeholders to use
+// positional placeholders, as generated by placeholder for the 1-based
+// position, and returns the rewritten query and the name for each position.
+// It is an error for the query to mix named and positional placeholders.
+func rewriteNamed(query string, placeholder func(n int) string) (string, []string, error) {
+  var b strings.Builder
+  var names []string
+  last := 0
+  for _, p := range findPlaceholders(query) {
+    if !isNamedPlaceholder(p.text) {
+      return "", nil, fmt.Errorf("query mixes named and positional placeholders (%s)", p.text)
+    }
+    names = append(names, p.text[1:])
+    b.WriteString(query[last:p.start])
+    b.WriteString(placeholder(len(names)))
+    last = p.end
+  }
+  b.WriteString(query[last:])
+  return b.String(), names, nil
+}
+
+// bindNamed rewrites a query that uses named placeholders as rewriteNamed
+// does, and returns the rewritten query and the args for it from the map
+// in args. It is an error for args to be anything other than one map with
+// string keys, or for the map to be missing a name. Unless allowUnused is
+// true, it is also an error for the map to have a name that is not used
+// by the query.
+func bindNamed(query string, args []interface{}, placeholder func(n int) string, allowUnused bool) (string, []interface{}, error) {
+  if len(args) != 1 {
+    return "", nil, fmt.Errorf("query with named placeholders needs one map arg, got %d args", len(args))
+  }
+  values, err := stringKeyedMap(args[0])
+  if err != nil {
+    return "", nil, err
+  }
+  query, names, err := rewriteNamed(query, placeholder)
+  if err != nil {
+    return "", nil, err
+  }
+  bound := make([]interface{}, len(names))
+  used := make(map[string]bool)
+  var missing []string
+  for i, name := range names {
+    v, ok := values[name]
+    if !ok && !used[name] {
+      missing = append(missing, name)
+    }
+    used[name] = true
+    bound[i] = v
+  }
+  if len(missing) > 0 {
+    return "", nil, fmt.Errorf("no value for named placeholder %s", strings.Join(missing, ", "))
+  }
+  if !allowUnused {
+    var unused []string
+    for name := range values {
+      if !used[name] {
+        unused = append(unused, name)
+      }
+    }
+    if len(unused) > 0 {
+      sort.Strings(unused)
+      return "", nil, fmt.Errorf("unused name %s for named placeholders", strings.Join(unused, ", "))
+    }
+  }
+  return query, bound, nil
+}
+
+// stringKeyedMap returns the entries of a map with keys that are strings,
+// such as a map[string]interface{}, a *data.Row, or a map from mkmap.
+// For a *data.Row, only its columns are used, not its rowindex.
+func stringKeyedMap(m interface{}) (map[string]interface{}, error) {
+  if r, ok := m.(*data.Row); ok {
+    values := make(map[string]interface{}, len(r.Col))
+    rv := r.Values()
+    for i, name := range r.Columns() {
+      values[name] = rv[i]
+    }
+    return values, nil
+  }
+  v := reflect.ValueOf(m)
+  if v.Kind() != reflect.Map {
+    return nil, fmt.Errorf("query with named placeholders needs a map arg, got %T", m)
+  }
+  values := make(map[string]interface{}, v.Len())
+  iter := v.MapRange()
+  for iter.Next() {
+    k, ok := iter.Key().Interface().(string)
+    if !ok {
+      return nil, fmt.Errorf("query with named placeholders needs a map with string keys, got key %v", iter.Key())
+    }
+    values[k] = iter.Value().Interface()
+  }
+  return values, nil
+}
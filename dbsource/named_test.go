@@ -0,0 +1,85 @@
+package dbsource
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func TestBindNamed(t *testing.T) {
+  dollar := func(n int) string {
+    return "$" + string(rune('0' + n))
+  }
+  query, args, err := bindNamed("select * from t where a = :a and b = @b and c = :a and d = ':x'",
+      []interface{}{map[string]interface{}{"a": 1, "b": "two"}}, dollar, false)
+  if err != nil {
+    t.Fatalf("bindNamed: %v", err)
+  }
+  if got, want := query, "select * from t where a = $1 and b = $2 and c = $3 and d = ':x'"; got != want {
+    t.Errorf("query: got %q, want %q", got, want)
+  }
+  if diff := cmp.Diff([]interface{}{1, "two", 1}, args); diff != "" {
+    t.Errorf("args (-want +got):\n%s", diff)
+  }
+
+  if _, _, err := bindNamed("select :a", []interface{}{map[string]interface{}{"a": 1, "z": 2}}, positionalPlaceholder, true); err != nil {
+    t.Errorf("bindNamed with unused names allowed: %v", err)
+  }
+
+  errTests := []struct{
+    name string
+    query string
+    args []interface{}
+    want string
+  }{
+    {"missing", "select :a, :b, :c", []interface{}{map[string]interface{}{"b": 1}}, "no value for named placeholder a, c"},
+    {"unused", "select :a", []interface{}{map[string]interface{}{"a": 1, "z": 2, "y": 3}}, "unused name y, z"},
+    {"mixed", "select :a, ?", []interface{}{map[string]interface{}{"a": 1}}, "mixes named and positional"},
+    {"not map", "select :a", []interface{}{"x"}, "needs a map arg, got string"},
+    {"key type", "select :a", []interface{}{map[int]int{1: 1}}, "needs a map with string keys"},
+    {"arg count", "select :a", []interface{}{map[string]interface{}{"a": 1}, 2}, "needs one map arg, got 2 args"},
+  }
+  for _, tt := range errTests {
+    _, _, err := bindNamed(tt.query, tt.args, positionalPlaceholder, false)
+    if err == nil {
+      t.Errorf("%s: expected error", tt.name)
+    } else if !strings.Contains(err.Error(), tt.want) {
+      t.Errorf("%s: got error %q, want %q", tt.name, err, tt.want)
+    }
+  }
+}
+
+func TestNamedPlaceholdersInTemplate(t *testing.T) {
+  db := testDb(t, ":memory:")
+  params := map[string]interface{}{
+    "company": "s",
+    "lastname": "Smith",
+  }
+  templ := `{{range rows "select firstname from person where companyid = :company and lastname = @lastname order by id" .}}` +
+      `{{.Col.firstname}};{{end}}` +
+      `{{(row "select name from company where id = :id" (mkmap "id" .company)).Col.name}}`
+  var b strings.Builder
+  if err := gen.New("named", false, &b, New(db)).FromString(templ, params); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "Tom;Tim;Jim;Sample Corp."; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+
+  templ = `{{range rows "select firstname from person where companyid = :company" .}}{{.Col.firstname}};{{end}}`
+  err := gen.New("named", false, &strings.Builder{}, New(db)).FromString(templ, params)
+  if err == nil || !strings.Contains(err.Error(), "unused name lastname") {
+    t.Errorf("Unused name: got error %v", err)
+  }
+  b.Reset()
+  source := New(db).WithUnusedNamesAllowed(true)
+  if err := gen.New("named", false, &b, source).FromString(templ, params); err != nil {
+    t.Fatalf("With unused names allowed: %v", err)
+  }
+  if got, want := b.String(), "Tom;Tim;Jim;"; got != want {
+    t.Errorf("With unused names allowed: got %q, want %q", got, want)
+  }
+}
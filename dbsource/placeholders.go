@@ -0,0 +1,119 @@
+package dbsource
+
+/* This file contains a scanner for the placeholders in a query string.
+ * It knows enough SQL syntax to skip over quoted strings, quoted identifiers
+ * and comments, so that a ? or :name within them is not taken as a placeholder.
+ */
+
+import (
+  "strconv"
+)
+
+// placeholder is one placeholder found in a query.
+type placeholder struct {
+  start, end int           // Offsets of the placeholder in the query.
+  text string
+}
+
+// findPlaceholders returns the placeholders in query that are outside of
+// quoted strings, quoted identifiers and comments. Placeholders are ?,
+// ?NNN and $NNN, and :name and @name. A :: (a postgres cast) and an @@
+// (a mysql system variable) are not placeholders.
+func findPlaceholders(query string) []placeholder {
+  var found []placeholder
+  n := len(query)
+  for i := 0; i < n; i++ {
+    c := query[i]
+    switch {
+    case c == '\'' || c == '"' || c == '`':
+      // Skip to the closing quote; a doubled quote is an escaped quote.
+      for i++; i < n; i++ {
+        if query[i] == c {
+          if i+1 < n && query[i+1] == c {
+            i++
+            continue
+          }
+          break
+        }
+      }
+    case c == '[':
+      for i++; i < n && query[i] != ']'; i++ {
+      }
+    case c == '-' && i+1 < n && query[i+1] == '-':
+      for i += 2; i < n && query[i] != '\n'; i++ {
+      }
+    case c == '/' && i+1 < n && query[i+1] == '*':
+      for i += 2; i+1 < n && !(query[i] == '*' && query[i+1] == '/'); i++ {
+      }
+      i++
+    case c == ':' && i+1 < n && query[i+1] == ':':
+      i++
+    case c == '@' && i+1 < n && query[i+1] == '@':
+      for i += 2; i < n && isIdentChar(query[i]); i++ {
+      }
+      i--
+    case c == '?':
+      j := i + 1
+      for j < n && isDigit(query[j]) {
+        j++
+      }
+      found = append(found, placeholder{i, j, query[i:j]})
+      i = j - 1
+    case c == '$' && i+1 < n && isDigit(query[i+1]):
+      j := i + 1
+      for j < n && isDigit(query[j]) {
+        j++
+      }
+      found = append(found, placeholder{i, j, query[i:j]})
+      i = j - 1
+    case (c == ':' || c == '@') && i+1 < n && isIdentStart(query[i+1]) &&
+        (i == 0 || !isIdentChar(query[i-1])):
+      j := i + 1
+      for j < n && isIdentChar(query[j]) {
+        j++
+      }
+      found = append(found, placeholder{i, j, query[i:j]})
+      i = j - 1
+    }
+  }
+  return found
+}
+
+// countPlaceholders returns the number of args needed by the placeholders
+// in query: one for each ?, the highest number of any ?NNN or $NNN,
+// and one for each distinct name.
+func countPlaceholders(query string) int {
+  positional := 0
+  highest := 0
+  names := make(map[string]bool)
+  for _, p := range findPlaceholders(query) {
+    switch {
+    case p.text == "?":
+      positional++
+    case p.text[0] == '?' || p.text[0] == '$':
+      if k, err := strconv.Atoi(p.text[1:]); err == nil && k > highest {
+        highest = k
+      }
+    default:
+      names[p.text[1:]] = true
+    }
+  }
+  return positional + highest + len(names)
+}
+
+// positionalPlaceholder returns the ? placeholder, for any position.
+func positionalPlaceholder(n int) string {
+  return "?"
+}
+
+func isDigit(c byte) bool {
+  return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+  return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+  return isIdentStart(c) || isDigit(c)
+}
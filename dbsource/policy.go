@@ -0,0 +1,441 @@
+package dbsource
+
+/* This file contains the policy that restricts the queries that a SqlSource
+ * will run, so that someone who can edit a template can't change the
+ * database or read tables that the reports should not see.
+ * We don't fully parse the SQL. We split the query into words, quoted
+ * identifiers and punctuation, skipping strings and comments, and look for
+ * the keywords that start or appear in statements that write, and for the
+ * names of tables after FROM and JOIN. This is conservative: a query that
+ * uses a write keyword anywhere, even as an unquoted column name, is rejected.
+ */
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+)
+
+// Policy restricts the queries that a SqlSource will run.
+// The zero Policy allows only SELECT and WITH queries, on any table.
+type Policy struct {
+  // AllowWrites allows statements other than SELECT and WITH queries,
+  // such as INSERT and DELETE.
+  AllowWrites bool
+  // Tables, if not nil, are the only tables that queries may use.
+  // Names are compared without regard to case, and a table in a schema
+  // must be listed with its schema, as in "main.person".
+  Tables []string
+}
+
+// PolicyError is the error for a query that is not allowed by a Policy.
+type PolicyError struct {
+  Query string
+  Reason string
+}
+
+func (e *PolicyError) Error() string {
+  return fmt.Sprintf("query not allowed by policy: %s: %q", e.Reason, e.Query)
+}
+
+// WithPolicy creates a copy of a source that only runs queries allowed by p.
+func (s *SqlSource) WithPolicy(p Policy) *SqlSource {
+  sc := *s
+  sc.policy = p
+  return &sc
+}
+
+// CheckTables implements data.TableChecker. It returns a PolicyError if
+// the query in args uses any table other than those in tables.
+func (s *SqlSource) CheckTables(tables []string, args ...interface{}) error {
+  query, err := queryArg(args)
+  if err != nil {
+    return err
+  }
+  return checkTables(query, tables)
+}
+
+// writeKeywords are the keywords that we don't allow anywhere in a read-only
+// query. Statements that start with other keywords, such as REPLACE or CALL,
+// are rejected because they don't start with SELECT or WITH.
+var writeKeywords = map[string]bool{
+  "alter": true,
+  "attach": true,
+  "create": true,
+  "delete": true,
+  "detach": true,
+  "drop": true,
+  "grant": true,
+  "insert": true,
+  "into": true,
+  "merge": true,
+  "pragma": true,
+  "revoke": true,
+  "truncate": true,
+  "update": true,
+  "vacuum": true,
+}
+
+// notAlias are the keywords that can follow a table name in a FROM
+// clause, so that they are not taken as an alias for the table.
+var notAlias = map[string]bool{
+  "cross": true, "except": true, "fetch": true, "for": true, "full": true,
+  "group": true, "having": true, "inner": true, "intersect": true,
+  "join": true, "left": true, "limit": true, "natural": true,
+  "offset": true, "on": true, "order": true, "outer": true, "right": true,
+  "union": true, "using": true, "where": true, "window": true,
+}
+
+// check returns a PolicyError if the query is not allowed by the policy.
+func (p *Policy) check(query string) error {
+  tokens := sqlTokens(query)
+  for i, t := range tokens {
+    if t.is(";") && i < len(tokens) - 1 {
+      return &PolicyError{query, "only one statement is allowed"}
+    }
+  }
+  if !p.AllowWrites {
+    first := ""
+    for _, t := range tokens {
+      if !t.is("(") {
+        first = t.keyword()
+        break
+      }
+    }
+    if first != "select" && first != "with" {
+      return &PolicyError{query, "only SELECT and WITH queries are allowed"}
+    }
+    for _, t := range tokens {
+      if k := t.keyword(); writeKeywords[k] {
+        return &PolicyError{query, fmt.Sprintf("%s is not allowed in a read-only query", strings.ToUpper(k))}
+      }
+    }
+  }
+  if p.Tables != nil {
+    return checkTables(query, p.Tables)
+  }
+  return nil
+}
+
+// checkTables returns a PolicyError if the query uses a table not in tables.
+func checkTables(query string, tables []string) error {
+  allowed := make(map[string]bool)
+  for _, t := range tables {
+    allowed[strings.ToLower(t)] = true
+  }
+  var denied []string
+  for _, t := range queryTables(query) {
+    if !allowed[t] {
+      denied = append(denied, t)
+    }
+  }
+  switch len(denied) {
+  case 0:
+    return nil
+  case 1:
+    return &PolicyError{query, fmt.Sprintf("table %s is not allowed", denied[0])}
+  default:
+    return &PolicyError{query, fmt.Sprintf("tables %s are not allowed", strings.Join(denied, ", "))}
+  }
+}
+
+// sqlToken is one word, quoted identifier or punctuation character of a query.
+type sqlToken struct {
+  text string            // For a quoted identifier, the name without its quotes.
+  word bool              // A word or quoted identifier.
+  quoted bool            // A quoted identifier.
+}
+
+// keyword returns the lower case text of an unquoted word, or else "".
+func (t sqlToken) keyword() string {
+  if !t.word || t.quoted {
+    return ""
+  }
+  return strings.ToLower(t.text)
+}
+
+// is returns true if t is the given punctuation.
+func (t sqlToken) is(punct string) bool {
+  return !t.word && t.text == punct
+}
+
+// sqlTokens splits a query into tokens, skipping whitespace and comments.
+// A string literal is returned as a single ' token.
+func sqlTokens(query string) []sqlToken {
+  var tokens []sqlToken
+  n := len(query)
+  for i := 0; i < n; i++ {
+    c := query[i]
+    switch {
+    case isSpace(c):
+    case c == '-' && i+1 < n && query[i+1] == '-':
+      for i += 2; i < n && query[i] != '\n'; i++ {
+      }
+    case c == '/' && i+1 < n && query[i+1] == '*':
+      for i += 2; i+1 < n && !(query[i] == '*' && query[i+1] == '/'); i++ {
+      }
+      i++
+    case c == '\'' || c == '"' || c == '`' || c == '[':
+      closing := c
+      if c == '[' {
+        closing = ']'
+      }
+      var b strings.Builder
+      for i++; i < n; i++ {
+        if query[i] == closing {
+          if i+1 < n && query[i+1] == closing {
+            i++
+          } else {
+            break
+          }
+        }
+        b.WriteByte(query[i])
+      }
+      if c == '\'' {
+        tokens = append(tokens, sqlToken{text: "'"})
+      } else {
+        tokens = append(tokens, sqlToken{text: b.String(), word: true, quoted: true})
+      }
+    case isIdentChar(c) || c == '$' || c >= 0x80:
+      j := i + 1
+      for j < n && (isIdentChar(query[j]) || query[j] == '$' || query[j] >= 0x80) {
+        j++
+      }
+      tokens = append(tokens, sqlToken{text: query[i:j], word: true})
+      i = j - 1
+    default:
+      tokens = append(tokens, sqlToken{text: query[i:i+1]})
+    }
+  }
+  return tokens
+}
+
+// queryTables returns the sorted lower case names of the tables used by
+// the query, which are the names after FROM and JOIN, and after INTO and
+// UPDATE for a statement that writes, other than those of common table
+// expressions defined with WITH where they are in scope. A FROM within the
+// parentheses of a function call, as in extract(year from d), is not a table.
+func queryTables(query string) []string {
+  tokens := sqlTokens(query)
+  found := make(map[string]bool)
+  // groups holds the index of each ( that starts a group of tables,
+  // as in from (a join b).
+  groups := make(map[int]bool)
+  // scopes[d] is the scope of the parentheses at depth d, or of the whole
+  // query for d = 0.
+  scopes := []*queryScope{{query: true}}
+  add := func(name string) {
+    if name == "" {
+      return
+    }
+    for _, sc := range scopes {
+      if sc.cteNames[name] {
+        return
+      }
+    }
+    found[name] = true
+  }
+  for i := 0; i < len(tokens); i++ {
+    t := tokens[i]
+    switch {
+    case t.is("("):
+      scopes = append(scopes, &queryScope{query: isSubquery(tokens, i) || groups[i]})
+      continue
+    case t.is(")"):
+      if len(scopes) > 1 {
+        scopes = scopes[:len(scopes) - 1]
+      }
+      continue
+    }
+    scope := scopes[len(scopes) - 1]
+    if !scope.query {
+      continue
+    }
+    switch t.keyword() {
+    case "with":
+      if scope.cteNames == nil {
+        scope.cteNames = make(map[string]bool)
+      }
+      readCTENames(tokens, i + 1, scope.cteNames)
+    case "from":
+      readTableList(tokens, i + 1, add, groups)
+    case "join":
+      readTable(tokens, i + 1, add, groups)
+    case "into":
+      name, _ := tableName(tokens, i + 1)
+      add(name)
+    case "update":
+      if i == 0 || tokens[i-1].keyword() != "for" {
+        name, _ := tableName(tokens, i + 1)
+        add(name)
+      }
+    }
+  }
+  var tables []string
+  for name := range found {
+    tables = append(tables, name)
+  }
+  sort.Strings(tables)
+  return tables
+}
+
+// queryScope is the query, or the parentheses within it, that we are in.
+type queryScope struct {
+  query bool                    // The scope holds a query or a group of tables.
+  cteNames map[string]bool      // The common table expressions defined here.
+}
+
+// isSubquery returns true if the ( at tokens[i] starts a subquery.
+func isSubquery(tokens []sqlToken, i int) bool {
+  if i+1 >= len(tokens) {
+    return false
+  }
+  next := tokens[i+1].keyword()
+  return next == "select" || next == "with" || next == "values"
+}
+
+// joinWords are the keywords of a join operator.
+var joinWords = map[string]bool{
+  "cross": true, "full": true, "inner": true, "join": true, "left": true,
+  "natural": true, "outer": true, "right": true,
+}
+
+// readTableList reads a list of tables, each with an optional alias and
+// joined by commas or join operators, starting at tokens[i], and calls add
+// with the name of each. It returns the index of the token after the list.
+func readTableList(tokens []sqlToken, i int, add func(string), groups map[int]bool) int {
+  i = skipAlias(tokens, readTable(tokens, i, add, groups))
+  for i < len(tokens) {
+    switch k := tokens[i].keyword(); {
+    case tokens[i].is(","):
+      i = skipAlias(tokens, readTable(tokens, i + 1, add, groups))
+    case joinWords[k]:
+      for i < len(tokens) && joinWords[tokens[i].keyword()] && tokens[i].keyword() != "join" {
+        i++
+      }
+      if i >= len(tokens) || tokens[i].keyword() != "join" {
+        return i
+      }
+      i = skipAlias(tokens, readTable(tokens, i + 1, add, groups))
+    case k == "on":
+      i = skipExpr(tokens, i + 1)
+    case k == "using":
+      i = skipParens(tokens, i + 1)
+    default:
+      return i
+    }
+  }
+  return i
+}
+
+// skipAlias returns the index of the token after the optional alias
+// of a table at tokens[i].
+func skipAlias(tokens []sqlToken, i int) int {
+  if i < len(tokens) && tokens[i].keyword() == "as" {
+    i++
+  }
+  if i < len(tokens) && tokens[i].word && !notAlias[tokens[i].keyword()] {
+    i++
+  }
+  return i
+}
+
+// skipExpr returns the index of the token after the expression of a join
+// constraint starting at tokens[i], which ends at a comma, a closing
+// parenthesis or the keyword of another join or clause.
+func skipExpr(tokens []sqlToken, i int) int {
+  for i < len(tokens) {
+    t := tokens[i]
+    switch k := t.keyword(); {
+    case t.is("("):
+      i = skipParens(tokens, i)
+      continue
+    case t.is(",") || t.is(")") || t.is(";"):
+      return i
+    case notAlias[k] && k != "on" && k != "using":
+      return i
+    }
+    i++
+  }
+  return i
+}
+
+// readTable reads a table, a subquery or a group of tables in parentheses
+// starting at tokens[i], and calls add with the name of each table outside
+// of a subquery. A group is recorded in groups, so that the JOINs within it
+// are read as those of a query. It returns the index of the token after it.
+func readTable(tokens []sqlToken, i int, add func(string), groups map[int]bool) int {
+  if i < len(tokens) && tokens[i].keyword() == "lateral" {
+    i++
+  }
+  if i < len(tokens) && tokens[i].is("(") {
+    if !isSubquery(tokens, i) {
+      groups[i] = true
+      readTableList(tokens, i + 1, add, groups)
+    }
+    return skipParens(tokens, i)
+  }
+  name, next := tableName(tokens, i)
+  add(name)
+  return next
+}
+
+// tableName reads a possibly qualified table name starting at tokens[i],
+// and returns it in lower case, with the index of the token after it.
+// It returns "" for a subquery or a function call, such as json_each(x).
+func tableName(tokens []sqlToken, i int) (string, int) {
+  if i >= len(tokens) || !tokens[i].word {
+    return "", i
+  }
+  parts := []string{strings.ToLower(tokens[i].text)}
+  i++
+  for i+1 < len(tokens) && tokens[i].is(".") && tokens[i+1].word {
+    parts = append(parts, strings.ToLower(tokens[i+1].text))
+    i += 2
+  }
+  if i < len(tokens) && tokens[i].is("(") {
+    return "", skipParens(tokens, i)
+  }
+  return strings.Join(parts, "."), i
+}
+
+// readCTENames adds the names of the common table expressions of a WITH
+// clause, starting at tokens[i], to names.
+func readCTENames(tokens []sqlToken, i int, names map[string]bool) {
+  if i < len(tokens) && tokens[i].keyword() == "recursive" {
+    i++
+  }
+  for i < len(tokens) && tokens[i].word {
+    names[strings.ToLower(tokens[i].text)] = true
+    i++
+    if i < len(tokens) && tokens[i].is("(") {
+      i = skipParens(tokens, i)     // The column names.
+    }
+    for i < len(tokens) && !tokens[i].is("(") {
+      i++                           // AS, and NOT MATERIALIZED.
+    }
+    i = skipParens(tokens, i)
+    if i >= len(tokens) || !tokens[i].is(",") {
+      return
+    }
+    i++
+  }
+}
+
+// skipParens returns the index of the token after the parenthesis that
+// matches the one at tokens[i].
+func skipParens(tokens []sqlToken, i int) int {
+  depth := 0
+  for ; i < len(tokens); i++ {
+    switch {
+    case tokens[i].is("("):
+      depth++
+    case tokens[i].is(")"):
+      depth--
+      if depth == 0 {
+        return i + 1
+      }
+    }
+  }
+  return i
+}
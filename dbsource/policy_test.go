@@ -0,0 +1,117 @@
+package dbsource
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func TestPolicy(t *testing.T) {
+  tables := []string{"person", "company"}
+  tests := []struct{
+    query string
+    policy Policy
+    wantErr string
+  }{
+    {"select * from person", Policy{}, ""},
+    {"  (select 1) union (select 2)", Policy{}, ""},
+    {"with p as (select * from person) select * from p", Policy{Tables: tables}, ""},
+    {"select replace(name, 'a', 'b'), 'delete' as \"update\" from company;", Policy{}, ""},
+    {"delete from company", Policy{}, "only SELECT and WITH queries are allowed"},
+    {"DELETE from company", Policy{AllowWrites: true}, ""},
+    {"with d as (delete from company returning *) select * from d", Policy{}, "DELETE is not allowed in a read-only query"},
+    {"select * into backup from company", Policy{}, "INTO is not allowed"},
+    {"select * from person; drop table person", Policy{AllowWrites: true}, "only one statement is allowed"},
+    {"select * from person -- ; drop table person", Policy{}, ""},
+    {"select * from secret", Policy{Tables: tables}, "table secret is not allowed"},
+    {"insert into secret select * from person", Policy{AllowWrites: true, Tables: tables}, "table secret is not allowed"},
+    {"update Person set firstname = 'x'", Policy{AllowWrites: true, Tables: tables}, ""},
+    {"select * from (secret)", Policy{Tables: tables}, "table secret is not allowed"},
+    {"select * from person join company on 1, secret", Policy{Tables: tables}, "table secret is not allowed"},
+    {"select * from person, (with secret as (select 1) select * from person) x, secret", Policy{Tables: tables},
+        "table secret is not allowed"},
+  }
+  for _, tt := range tests {
+    err := tt.policy.check(tt.query)
+    if tt.wantErr == "" {
+      if err != nil {
+        t.Errorf("%q: unexpected error: %v", tt.query, err)
+      }
+      continue
+    }
+    if err == nil {
+      t.Errorf("%q: expected error %q", tt.query, tt.wantErr)
+    } else if _, ok := err.(*PolicyError); !ok || !strings.Contains(err.Error(), tt.wantErr) {
+      t.Errorf("%q: got error %v, want PolicyError %q", tt.query, err, tt.wantErr)
+    }
+  }
+}
+
+func TestQueryTables(t *testing.T) {
+  tests := []struct{
+    query string
+    want []string
+  }{
+    {"select 1", nil},
+    {"select * from person p, company as c, main.Other o where p.id = ?", []string{"company", "main.other", "person"}},
+    {"select * from person join company on 1 left outer join \"Odd Name\" x using (id)", []string{"company", "odd name", "person"}},
+    {"select extract(year from created), substring(name from 2) from t", []string{"t"}},
+    {"select * from (select id from a) s where id in (select id from b)", []string{"a", "b"}},
+    {"with recursive x(n) as (select 1 union select n+1 from x), y as not materialized (select * from z) " +
+        "select * from x, y", []string{"z"}},
+    {"select * from json_each(?) j, person", []string{"person"}},
+    {"select * from t for update of t", []string{"t"}},
+    {"select * from [dbo].[t] where a = 'from x'", []string{"dbo.t"}},
+    {"select * from (secret)", []string{"secret"}},
+    {"select * from a, (b join (c) on 1, (d)) g join (e) on 1", []string{"a", "b", "c", "d", "e"}},
+    {"select * from (select id from a) s, b, lateral (select 1) l, c", []string{"a", "b", "c"}},
+    {"select * from a where x in (b)", []string{"a"}},
+    {"select * from a join b on a.x = f(b.y, 1) and 1, c natural left outer join d using (id), e", []string{"a", "b", "c", "d", "e"}},
+    // A common table expression is only in scope in its own query.
+    {"select * from pub, (with secret as (select 1) select * from secret) x, secret", []string{"pub", "secret"}},
+    {"with x as (select 1) select * from (select * from x), (with y as (select 2) select * from x, y) z", nil},
+  }
+  for _, tt := range tests {
+    if diff := cmp.Diff(tt.want, queryTables(tt.query)); diff != "" {
+      t.Errorf("queryTables(%q) (-want +got):\n%s", tt.query, diff)
+    }
+  }
+}
+
+func TestTemplateTables(t *testing.T) {
+  db := testDb(t, ":memory:")
+  refpaths := []string{"testdata/policy"}
+  sources := []data.Source{New(db), data.NewCachingSource(New(db), data.CacheOptions{})}
+  for _, source := range sources {
+    var b strings.Builder
+    if err := gen.New("policyreport", false, &b, source).FromTemplate(refpaths, nil); err != nil {
+      t.Fatalf("%T: %v", source, err)
+    }
+    if got, want := b.String(), "John;Jane;\nExample, Inc.\n\n"; got != want {
+      t.Errorf("%T: got %q, want %q", source, got, want)
+    }
+    // The include may only use the tables that the including template may use.
+    err := gen.New("policyperson", false, &strings.Builder{}, source).FromTemplate(refpaths, nil)
+    if err == nil || !strings.Contains(err.Error(), "table company is not allowed") {
+      t.Errorf("%T: policyperson: got error %v", source, err)
+    }
+  }
+
+  templ := "{{/*GT: {\"tables\": [\"company\"]} */ -}}\n" + `{{rows "select * from person"}}`
+  err := gen.New("tables", false, &strings.Builder{}, New(db).WithPolicy(Policy{AllowWrites: true})).FromString(templ, nil)
+  if err == nil || !strings.Contains(err.Error(), "table person is not allowed") {
+    t.Errorf("Template tables: got error %v", err)
+  }
+  err = gen.New("tables", false, &strings.Builder{}, &data.EmptySource{}).FromString(templ, nil)
+  if err == nil || !strings.Contains(err.Error(), "can't check them") {
+    t.Errorf("Template tables with EmptySource: got error %v", err)
+  }
+  err = gen.New("writes", false, &strings.Builder{}, New(db)).FromString(`{{rows "delete from person"}}`, nil)
+  if err == nil || !strings.Contains(err.Error(), "only SELECT and WITH queries are allowed") {
+    t.Errorf("Write query: got error %v", err)
+  }
+}
@@ -6,6 +6,8 @@ import (
   "fmt"
 
   "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/data"
 )
 
 // DBQuery represents the functions we use from a database.
@@ -16,6 +18,12 @@ type DBQuery interface{
 
 type SqlSource struct{
   db DBQuery;
+  streaming bool;
+  converter *Converter;
+  allowUnusedNames bool;
+  dialect *Dialect;
+  runTx *sql.TxOptions;
+  policy Policy;
 }
 
 // New creates a new SqlSource from a database or transaction.
@@ -25,72 +33,208 @@ func New(db DBQuery) *SqlSource {
   }
 }
 
+// WithStreaming creates a copy of a source with streaming turned on or off.
+// When streaming, Rows returns a *data.RowStream rather than reading all of
+// the rows into memory, so that a template can range over a large result.
+// Row is not affected.
+func (s *SqlSource) WithStreaming(streaming bool) *SqlSource {
+  sc := *s
+  sc.streaming = streaming
+  return &sc
+}
+
 // Rows gets multiple rows from our database. The first arg is the query string, and all
 // following args are passed to the Query function as arguments for the query string.
-// This function may return zero or more rows.
+// This function may return zero or more rows, as a []*data.Row,
+// or as a *data.RowStream if streaming is on.
+// For compatibility with older templates, each row also has its index in the
+// rowindex entry of its Col, unless the query has a column with that name.
 func (s *SqlSource) Rows(args ...interface{}) (interface{}, error) {
-  query, ok := args[0].(string)
-  if !ok {
-    return nil, errors.New("SqlSource.Data first arg must be string (query)")
+  rr, err := s.query(args)
+  if err != nil {
+    return nil, err
+  }
+  if s.streaming {
+    return data.NewRowStream(func(send func(*data.Row) bool) error {
+      defer rr.Close()
+      return s.scanRows(rr, -1, send)
+    }), nil
+  }
+  defer rr.Close()
+  columns, err := columnsOf(rr)
+  if err != nil {
+    return nil, err
+  }
+  // Read all of the values first, so that we know the count for RowMeta.
+  var values [][]interface{}
+  err = s.scanValues(rr, columns, func(v []interface{}) bool {
+    values = append(values, v)
+    return true
+  })
+  if err != nil {
+    return nil, err
+  }
+  result := make([]*data.Row, len(values))
+  for i, v := range values {
+    result[i] = newRow(columns, v, i, len(values), i == len(values) - 1)
+  }
+  return result, nil
+}
+
+// query runs the query specified by args.
+func (s *SqlSource) query(args []interface{}) (*sql.Rows, error) {
+  query, err := queryArg(args)
+  if err != nil {
+    return nil, err
   }
   glog.V(2).Infof("Query string is: %q", query)
+  if err := s.policy.check(query); err != nil {
+    return nil, err
+  }
+  args, _ = data.StripNoCache(args)
   queryArgs := args[1:]
+  if hasNamedPlaceholders(query) {
+    var err error
+    query, queryArgs, err = bindNamed(query, queryArgs, positionalPlaceholder, s.allowUnusedNames)
+    if err != nil {
+      return nil, err
+    }
+    glog.V(2).Infof("Query string with named placeholders bound is: %q", query)
+  }
+  if hasListArg(queryArgs) {
+    var err error
+    query, queryArgs, err = expandLists(query, queryArgs)
+    if err != nil {
+      return nil, err
+    }
+    glog.V(2).Infof("Query string with lists expanded is: %q", query)
+  }
+  if s.dialect != nil {
+    query = s.dialect.rewritePlaceholders(query)
+  }
   glog.V(3).Infof("Query args are: %v", queryArgs)
   rr, err := s.db.Query(query, queryArgs...)
   if err != nil {
     return nil, err
   }
   glog.V(1).Infof("Got query results")
-  var colNames []string
-  fieldCount := -1
-  // We need to return either an array or a channel.
-  // For now, read all the rows and return an array.
-  data := make([]map[string]interface{}, 0)
-  rowindex := 0
-  for rr.Next() {
-    if fieldCount < 0 {
-      colNames, err = rr.Columns()
-      if err != nil {
-        return nil, err
-      }
-      fieldCount = len(colNames)
-      glog.V(1).Infof("cols are %+v", colNames)
+  return rr, nil
+}
+
+// queryArg returns the query from the args of Row or Rows.
+func queryArg(args []interface{}) (string, error) {
+  args, _ = data.StripNoCache(args)
+  if len(args) == 0 {
+    return "", errors.New("SqlSource.Data requires a query")
+  }
+  query, ok := args[0].(string)
+  if !ok {
+    return "", errors.New("SqlSource.Data first arg must be string (query)")
+  }
+  return query, nil
+}
+
+// columnsOf returns the descriptions of the columns of rr.
+func columnsOf(rr *sql.Rows) ([]*data.Column, error) {
+  types, err := rr.ColumnTypes()
+  if err != nil {
+    return nil, err
+  }
+  columns := make([]*data.Column, len(types))
+  for i, t := range types {
+    nullable, ok := t.Nullable()
+    columns[i] = &data.Column{
+      Name: t.Name(),
+      DatabaseType: t.DatabaseTypeName(),
+      Nullable: nullable,
+      NullableKnown: ok,
     }
+  }
+  glog.V(1).Infof("cols are %+v", columns)
+  return columns, nil
+}
+
+// scanValues reads the values of each row from rr, converts them with
+// our converter, and passes them to f, until there are no more rows or
+// f returns false.
+func (s *SqlSource) scanValues(rr *sql.Rows, columns []*data.Column, f func([]interface{}) bool) error {
+  fieldCount := len(columns)
+  for rr.Next() {
     values := make([]interface{}, fieldCount)
     targets := make([]interface{}, fieldCount)
     for i := 0; i < len(values); i++ {
       targets[i] = &values[i]
     }
     if err := rr.Scan(targets...); err != nil {
-      return nil, err
+      return err
     }
-    // Build a map so we can access fields by name.
-    m := make(map[string]interface{})
     for i := 0; i < len(values); i++ {
-      // We assume values of type []byte are strings.
-      switch v := values[i].(type) {
-      case []byte:
-        values[i] = string(v)
+      v, err := s.converter.convert(columns[i], values[i])
+      if err != nil {
+        return err
       }
-      m[colNames[i]] = values[i]
+      values[i] = v
     }
-    m["rowindex"] = rowindex
-    rowindex++
     glog.V(1).Infof("row is %+v", values)
-    data = append(data, m)
+    if !f(values) {
+      return nil
+    }
+  }
+  return rr.Err()
+}
+
+// scanRows reads each row from rr and passes it to f, until there are
+// no more rows or f returns false. We read one row ahead so that we can
+// tell f which row is the last one. Count is the value for RowMeta.Count.
+func (s *SqlSource) scanRows(rr *sql.Rows, count int, f func(*data.Row) bool) error {
+  columns, err := columnsOf(rr)
+  if err != nil {
+    return err
+  }
+  var pending []interface{}
+  index := 0
+  stopped := false
+  err = s.scanValues(rr, columns, func(values []interface{}) bool {
+    if pending != nil {
+      if !f(newRow(columns, pending, index, count, false)) {
+        stopped = true
+        return false
+      }
+      index++
+    }
+    pending = values
+    return true
+  })
+  if err != nil || stopped || pending == nil {
+    return err
+  }
+  f(newRow(columns, pending, index, count, true))
+  return nil
+}
+
+// newRow creates a Row with its metadata and the rowindex field.
+func newRow(columns []*data.Column, values []interface{}, index, count int, last bool) *data.Row {
+  r := data.NewRow(columns, values, data.RowMeta{
+    Index: index,
+    Count: count,
+    First: index == 0,
+    Last: last,
+  })
+  if _, ok := r.Col["rowindex"]; !ok {
+    r.Col["rowindex"] = index
   }
-  return data, nil
+  return r
 }
 
 // Row gets exactly one row from our database. The first arg is the query string, and all
 // following args are passed to the Query function as arguments for the query string.
 // If the database returns either zero rows or two or more rows, this function returns an error.
 func (s *SqlSource) Row(args ...interface{}) (interface{}, error) {
-  data, err := s.Rows(args...)
+  result, err := s.WithStreaming(false).Rows(args...)
   if err != nil {
     return nil, err
   }
-  rows, ok := data.([]map[string]interface{})
+  rows, ok := result.([]*data.Row)
   if !ok {
     return nil, fmt.Errorf("SqlSource.Row unexpected type returned from Rows")
   }
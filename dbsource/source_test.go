@@ -3,8 +3,14 @@ package dbsource
 import (
   "database/sql"
   "io"
+  "path"
+  "strings"
   "testing"
+  "time"
 
+  "github.com/google/go-cmp/cmp"
+
+  "github.com/jimmc/gtrepgen/data"
   "github.com/jimmc/gtrepgen/gen"
 
   goldenbase "github.com/jimmc/golden/base"
@@ -13,6 +19,21 @@ import (
   _ "github.com/mattn/go-sqlite3"
 )
 
+// testDb opens the database at dsn, loads the test setup into it,
+// and closes it when the test ends.
+func testDb(t *testing.T, dsn string) *sql.DB {
+  t.Helper()
+  db, err := sql.Open("sqlite3", dsn)
+  if err != nil {
+    t.Fatalf("Opening database: %v", err)
+  }
+  t.Cleanup(func() { db.Close() })
+  if err := goldendb.LoadSetupFile(db, "testdata/dbsourcetest.sql"); err != nil {
+    t.Fatalf("Loading database: %v", err)
+  }
+  return db
+}
+
 func TestDbSource(t *testing.T) {
   sqlFile := "testdata/dbsourcetest.sql"
   tplname := "org.jimmc.gtrepgen.sqltest"
@@ -30,3 +51,145 @@ func TestDbSource(t *testing.T) {
 
   goldenbase.FatalIfError(t, goldenbase.RunOne(r), "Run")
 }
+
+func TestCachingSqlSource(t *testing.T) {
+  db := testDb(t, ":memory:")
+  source := data.NewCachingSource(New(db), data.CacheOptions{})
+  var b strings.Builder
+  g := gen.New("cache", false, &b, source)
+  templ := `{{range rows "select companyid from person order by id"}}` +
+      `{{(row "select name from company where id = ?" .Col.companyid).Col.name}};{{end}}` +
+      `{{(row noCache "select name from company where id = ?" "x").Col.name}}`
+  if err := g.FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "Example, Inc.;Example, Inc.;Sample Corp.;Sample Corp.;Sample Corp.;Example, Inc."; got != want {
+    t.Errorf("Output: got %q, want %q", got, want)
+  }
+  want := data.CacheStats{Hits: 3, Misses: 3, Uncached: 1}
+  if got := source.Stats(); got != want {
+    t.Errorf("Stats: got %+v, want %+v", got, want)
+  }
+}
+
+func TestStreamingSqlSource(t *testing.T) {
+  db := testDb(t, path.Join(t.TempDir(), "test.db"))
+  source := New(db).WithStreaming(true)
+  tests := []struct{
+    name string
+    templ string
+    want string
+    wantErr bool
+  }{
+    {"all", `{{range rows "select id from person order by id"}}{{.Col.id}}{{.Col.rowindex}} {{end}}` +
+        `{{(row "select name from company where id = ?" "x").Col.name}}`,
+        "p10 p21 p32 p43 p54 Example, Inc.", false},
+    {"nested", `{{range rows "select id, companyid from person where id < 'p3' order by id"}}` +
+        `{{range rows "select name from company where id = ?" .Col.companyid}}{{.Col.name}};{{end}}{{end}}`,
+        "Example, Inc.;Example, Inc.;", false},
+    {"failed", `{{range rows "select id from person order by id"}}` +
+        `{{if eq .Col.id "p3"}}{{required nil}}{{end}}{{.Col.id}} {{end}}`,
+        "p1 p2 ", true},
+  }
+  for _, tt := range tests {
+    var b strings.Builder
+    g := gen.New(tt.name, false, &b, source)
+    err := g.FromString(tt.templ, nil)
+    if gotErr := err != nil; gotErr != tt.wantErr {
+      t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+    }
+    if got := b.String(); got != tt.want {
+      t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+    }
+    if got := db.Stats().InUse; got != 0 {
+      t.Errorf("%s: %d connections still in use after render", tt.name, got)
+    }
+  }
+}
+
+func TestStreamingEarlyBreak(t *testing.T) {
+  db := testDb(t, path.Join(t.TempDir(), "test.db"))
+  db.SetMaxOpenConns(3)
+  source := New(db).WithStreaming(true)
+  // Each inner range stops early, so its query must be closed at the break
+  // rather than at the end of the run, or we would run out of connections.
+  templ := `{{range rows "select id from person order by id"}}{{.Col.id}}:` +
+      `{{range rows "select id from person where id >= ? order by id" .Col.id}}{{.Col.id}}{{break}}{{end}}` +
+      `{{range $i, $p := rows "select id from person order by id"}}{{if eq $i 1}}{{break}}{{end}}{{$p.Col.id}}{{end}};{{end}}`
+  for _, isHTML := range []bool{false, true} {
+    var b strings.Builder
+    done := make(chan error)
+    go func() {
+      done <- gen.New("earlybreak", isHTML, &b, source).FromString(templ, nil)
+    }()
+    select {
+    case err := <-done:
+      if err != nil {
+        t.Fatalf("html=%v: %v", isHTML, err)
+      }
+    case <-time.After(10 * time.Second):
+      t.Fatalf("html=%v: timed out, %d connections in use", isHTML, db.Stats().InUse)
+    }
+    if got, want := b.String(), "p1:p1p1;p2:p2p1;p3:p3p1;p4:p4p1;p5:p5p1;"; got != want {
+      t.Errorf("html=%v: got %q, want %q", isHTML, got, want)
+    }
+    if got := db.Stats().InUse; got != 0 {
+      t.Errorf("html=%v: %d connections still in use after render", isHTML, got)
+    }
+  }
+}
+
+func TestStreamingStats(t *testing.T) {
+  db := testDb(t, path.Join(t.TempDir(), "test.db"))
+  templ := `{{range rows "select id from person order by id"}}{{.Col.id}}{{end}};` +
+      `{{range rows "select id from person where id > ? order by id" "p1"}}{{if eq .Col.id "p4"}}{{break}}{{end}}{{.Col.id}}{{end}}`
+  var b strings.Builder
+  var stats gen.RunStats
+  g := gen.New("streamstats", false, &b, New(db).WithStreaming(true)).WithRunStats(&stats)
+  if err := g.FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "p1p2p3p4p5;p2p3"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+  // The rows are counted as they are read, including the one before the break.
+  var got []int
+  for _, q := range stats.Queries {
+    got = append(got, q.Rows)
+  }
+  if diff := cmp.Diff([]int{5, 3}, got); diff != "" {
+    t.Errorf("Rows in stats (-want +got):\n%s", diff)
+  }
+}
+
+func TestRowMetadata(t *testing.T) {
+  db := testDb(t, ":memory:")
+  templ := `{{range rows "select name, id, 1 as rowindex from company order by id"}}` +
+      `{{if .Meta.First}}{{range .ColumnTypes}}{{.Name}}:{{.DatabaseType}} {{end}}{{.Meta.Count}}|{{end}}` +
+      `{{range .Values}}{{.}},{{end}}{{.Meta.Index}}{{if .Meta.Last}}.{{else}}|{{end}}{{end}}`
+  for _, streaming := range []bool{false, true} {
+    var b strings.Builder
+    g := gen.New("meta", false, &b, New(db).WithStreaming(streaming))
+    if err := g.FromString(templ, nil); err != nil {
+      t.Fatal(err)
+    }
+    count := "2"
+    if streaming {
+      count = "-1"
+    }
+    want := "name:string id:string rowindex: " + count + "|Sample Corp.,s,1,0|Example, Inc.,x,1,1."
+    if got := b.String(); got != want {
+      t.Errorf("streaming=%v: got %q, want %q", streaming, got, want)
+    }
+  }
+
+  // Ranging over the Col of a row sees the columns and rowindex, but not the metadata.
+  var b strings.Builder
+  templ = `{{range rows "select name, id from company order by id"}}{{len .Col}}:{{range $k, $v := .Col}}{{$k}}={{$v}} {{end}}|{{end}}`
+  if err := gen.New("rowmap", false, &b, New(db)).FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "3:id=s name=Sample Corp. rowindex=0 |3:id=x name=Example, Inc. rowindex=1 |"; got != want {
+    t.Errorf("Range over row: got %q, want %q", got, want)
+  }
+}
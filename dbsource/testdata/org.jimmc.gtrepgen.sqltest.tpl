@@ -1,11 +1,11 @@
 Report for companyid {{.}}
 Company data:
 {{with row "select name from company where id = ?" .}}
-    Name: {{.name}}
+    Name: {{.Col.name}}
 {{end}}
 People in that company:
 {{range rows "select firstname, lastname from person where companyid = ?" .}}
-    First name: {{.firstname}}
-    Last name:  {{.lastname}}
-    rowindex:   {{.rowindex}}
+    First name: {{.Col.firstname}}
+    Last name:  {{.Col.lastname}}
+    rowindex:   {{.Col.rowindex}}
 {{end}}
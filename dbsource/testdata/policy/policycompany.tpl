@@ -0,0 +1,2 @@
+{{/*GT: {"tables": ["company", "secret"]} */ -}}
+{{(row "select name from company where id = 'x'").Col.name}}
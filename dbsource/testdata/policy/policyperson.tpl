@@ -0,0 +1,3 @@
+{{/*GT: {"tables": ["person"]} */ -}}
+{{(row "select count(*) as n from person").Col.n}}
+{{include "policycompany"}}
@@ -0,0 +1,3 @@
+{{/*GT: {"tables": ["person", "company"]} */ -}}
+{{range rows "select p.firstname from person p join company c on c.id = p.companyid where c.id = 'x' order by p.id"}}{{.Col.firstname}};{{end}}
+{{include "policycompany"}}
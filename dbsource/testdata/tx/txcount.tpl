@@ -0,0 +1 @@
+{{(row "select count(id) as n from person").Col.n}}
\ No newline at end of file
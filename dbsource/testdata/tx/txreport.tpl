@@ -0,0 +1 @@
+{{(row "select count(*) as n from person").Col.n}} {{addPerson}}{{include "txcount"}}
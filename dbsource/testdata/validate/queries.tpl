@@ -0,0 +1,12 @@
+{{with row "select name from company where id = ?" .}}{{.Col.name}}{{end}}
+{{range rows "select firstname, lastname from person where companyid = ?" .}}{{.Col.firstname}}{{end}}
+{{range rows "select nosuchcolumn from person"}}{{.}}{{end}}
+{{range rows "select * from nosuchtable"}}{{.}}{{end}}
+{{range rows "select * from person where"}}{{.}}{{end}}
+{{with row "select * from company where id = ? and name = ?" .}}{{.}}{{end}}
+{{with . | try "row" "select * from company where id = ?"}}{{.Value}}{{end}}
+{{range rows .query}}{{.}}{{end}}
+{{range rows "select * from person where companyid = :company and id <> :company" .}}{{.Col.id}}{{end}}
+{{range rows "select * from person where companyid = :company" "x" "y"}}{{.Col.id}}{{end}}
+{{range query "company_people" .}}{{.Col.firstname}}{{end}}
+{{range query "bad_column"}}{{.}}{{end}}
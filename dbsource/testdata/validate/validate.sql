@@ -0,0 +1,5 @@
+-- name: company_people
+select firstname, lastname from person where companyid = ?
+
+-- name: bad_column
+select nosuchcolumn from person
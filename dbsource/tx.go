@@ -0,0 +1,100 @@
+package dbsource
+
+/* This file contains support for running all of the queries of a report run
+ * in one read-only transaction, so that a long report sees a consistent
+ * snapshot of the database while writers are active. The generator calls
+ * BeginRun at the start of each run and uses the returned source, which
+ * queries the transaction, for every query of the run, including those in
+ * included templates.
+ */
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "strings"
+
+  "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+// DBBeginner represents a database that can start a transaction, such as a sql.DB.
+type DBBeginner interface{
+  BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// WithRunTransaction creates a copy of a source that runs the queries of
+// each report run in a read-only transaction with the isolation level of
+// opts, or that does not if opts is nil. The transaction is always read-only,
+// whatever the ReadOnly field of opts. The database of the source must be
+// a DBBeginner, such as a sql.DB.
+func (s *SqlSource) WithRunTransaction(opts *sql.TxOptions) *SqlSource {
+  sc := *s
+  if opts != nil {
+    sc.runTx = &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: true}
+  } else {
+    sc.runTx = nil
+  }
+  return &sc
+}
+
+// BeginRun implements data.RunSource. If the source has a run transaction,
+// it begins the transaction and returns a source that queries it, with a
+// function that commits the transaction if the run succeeded or else rolls
+// it back. Otherwise it returns the source itself.
+func (s *SqlSource) BeginRun() (data.Source, func(err error) error, error) {
+  if s.runTx == nil {
+    return s, func(err error) error { return nil }, nil
+  }
+  db, ok := s.db.(DBBeginner)
+  if !ok {
+    return nil, nil, fmt.Errorf("can't begin a run transaction on a %T", s.db)
+  }
+  tx, err := db.BeginTx(context.Background(), s.runTx)
+  if err != nil {
+    return nil, nil, fmt.Errorf("beginning run transaction: %v", err)
+  }
+  glog.V(1).Infof("Began run transaction with isolation %v", s.runTx.Isolation)
+  sc := *s
+  sc.db = tx
+  sc.runTx = nil
+  return &sc, func(runErr error) error {
+    if runErr != nil {
+      glog.V(1).Infof("Rolling back run transaction")
+      if err := tx.Rollback(); err != nil {
+        return fmt.Errorf("rolling back run transaction: %v", err)
+      }
+      return nil
+    }
+    glog.V(1).Infof("Committing run transaction")
+    if err := tx.Commit(); err != nil {
+      return fmt.Errorf("committing run transaction: %v", err)
+    }
+    return nil
+  }, nil
+}
+
+// isolationLevels are the isolation levels that ParseIsolationLevel accepts.
+var isolationLevels = []sql.IsolationLevel{
+  sql.LevelDefault,
+  sql.LevelReadUncommitted,
+  sql.LevelReadCommitted,
+  sql.LevelWriteCommitted,
+  sql.LevelRepeatableRead,
+  sql.LevelSnapshot,
+  sql.LevelSerializable,
+  sql.LevelLinearizable,
+}
+
+// ParseIsolationLevel returns the isolation level with the given name,
+// such as "repeatable-read", "Repeatable Read" or "snapshot".
+func ParseIsolationLevel(name string) (sql.IsolationLevel, error) {
+  normalized := strings.ToLower(strings.NewReplacer("-", " ", "_", " ").Replace(name))
+  for _, level := range isolationLevels {
+    if strings.ToLower(level.String()) == normalized {
+      return level, nil
+    }
+  }
+  return sql.LevelDefault, fmt.Errorf("unknown isolation level %q", name)
+}
@@ -0,0 +1,84 @@
+package dbsource
+
+import (
+  "database/sql"
+  "path"
+  "strings"
+  "testing"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func TestRunTransaction(t *testing.T) {
+  // In WAL mode a writer does not wait for readers, and a read transaction
+  // sees the database as of its first read.
+  db := testDb(t, path.Join(t.TempDir(), "test.db") + "?_journal_mode=WAL")
+  added := 0
+  funcs := map[string]interface{}{
+    "addPerson": func() (string, error) {
+      added++
+      _, err := db.Exec("insert into person(id, companyid) values(?, 'x')", "new" + string(rune('0' + added)))
+      return "", err
+    },
+  }
+  txOpts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+  tests := []struct{
+    name string
+    source data.Source
+    want string
+  }{
+    {"no transaction", New(db), "5 6"},
+    {"transaction", New(db).WithRunTransaction(txOpts), "6 6"},
+    {"cached transaction", data.NewCachingSource(New(db).WithRunTransaction(txOpts), data.CacheOptions{}), "7 7"},
+    {"transaction off", New(db).WithRunTransaction(txOpts).WithRunTransaction(nil), "8 9"},
+  }
+  for _, tt := range tests {
+    var b strings.Builder
+    g := gen.New("txreport", false, &b, tt.source).WithFuncs(funcs)
+    if err := g.FromTemplate([]string{"testdata/tx"}, nil); err != nil {
+      t.Fatalf("%s: %v", tt.name, err)
+    }
+    if got := strings.TrimSpace(b.String()); got != tt.want {
+      t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+    }
+    if got := db.Stats().InUse; got != 0 {
+      t.Errorf("%s: %d connections still in use after render", tt.name, got)
+    }
+  }
+
+  // A failed run rolls back its transaction.
+  source := New(db).WithRunTransaction(txOpts).WithStreaming(true)
+  templ := `{{range rows "select id from person"}}{{required nil}}{{end}}`
+  if err := gen.New("txfail", false, &strings.Builder{}, source).FromString(templ, nil); err == nil {
+    t.Errorf("Expected error from failed run")
+  }
+  if got := db.Stats().InUse; got != 0 {
+    t.Errorf("Failed run: %d connections still in use after render", got)
+  }
+}
+
+func TestRunTransactionErrors(t *testing.T) {
+  source := New(&recordingDB{}).WithRunTransaction(&sql.TxOptions{})
+  err := gen.New("txerror", false, &strings.Builder{}, source).FromString(`{{row "select 1"}}`, nil)
+  if err == nil || !strings.Contains(err.Error(), "can't begin a run transaction") {
+    t.Errorf("Expected error beginning transaction, got %v", err)
+  }
+}
+
+func TestParseIsolationLevel(t *testing.T) {
+  for name, want := range map[string]sql.IsolationLevel{
+    "default": sql.LevelDefault,
+    "repeatable-read": sql.LevelRepeatableRead,
+    "Read Committed": sql.LevelReadCommitted,
+    "snapshot": sql.LevelSnapshot,
+    "SERIALIZABLE": sql.LevelSerializable,
+  } {
+    if got, err := ParseIsolationLevel(name); err != nil || got != want {
+      t.Errorf("ParseIsolationLevel(%q): got %v, %v, want %v", name, got, err, want)
+    }
+  }
+  if _, err := ParseIsolationLevel("dirty"); err == nil {
+    t.Errorf("ParseIsolationLevel(dirty): expected error")
+  }
+}
@@ -0,0 +1,86 @@
+package dbsource
+
+import (
+  "database/sql"
+  "fmt"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+// DBPreparer represents the functions we use from a database to validate queries.
+// It is designed to accept either a sql.DB or a sql.Tx.
+type DBPreparer interface{
+  DBQuery
+  Prepare(query string) (*sql.Stmt, error)
+}
+
+// ValidateQueries prepares each of the queries against the database and
+// returns a diagnostic for each query that can't be prepared, such as for
+// a syntax error or an unknown table or column, and for each query whose
+// number of placeholders is different from the number of args passed to it.
+// If explain is true, each query is also run with EXPLAIN, with nil args,
+// for drivers that don't check the query until it is run.
+func ValidateQueries(db DBPreparer, queries []*gen.QueryRef, explain bool) []*gen.Diagnostic {
+  return ValidateDialectQueries(db, SQLite, queries, explain)
+}
+
+// ValidateDialectQueries is like ValidateQueries for a database of the given
+// dialect, so that the queries are checked with their placeholders rewritten
+// as SqlSource.WithDialect does. Queries are not run with EXPLAIN for a
+// dialect that does not support it.
+func ValidateDialectQueries(db DBPreparer, d *Dialect, queries []*gen.QueryRef, explain bool) []*gen.Diagnostic {
+  var diags []*gen.Diagnostic
+  for _, q := range queries {
+    if err := validateQuery(db, d, q, explain && d.explain != ""); err != nil {
+      diags = append(diags, err)
+    }
+  }
+  return diags
+}
+
+func validateQuery(db DBPreparer, d *Dialect, q *gen.QueryRef, explain bool) *gen.Diagnostic {
+  query := q.Query
+  numInput := countPlaceholders(query)
+  argCount := numInput
+  if hasNamedPlaceholders(query) {
+    // Check the query as it will be run, with the names rewritten.
+    rewritten, names, err := rewriteNamed(query, positionalPlaceholder)
+    if err != nil {
+      return q.Diagnostic(gen.SeverityError, "sql", fmt.Sprintf("%s: %v", queryLabel(q), err))
+    }
+    query = rewritten
+    numInput = len(names)
+    argCount = 1        // The map of values for the names.
+  }
+  query = d.rewritePlaceholders(query)
+  stmt, err := db.Prepare(query)
+  if err != nil {
+    return q.Diagnostic(gen.SeverityError, "sql", fmt.Sprintf("%s: %v", queryLabel(q), err))
+  }
+  stmt.Close()
+  if argCount != q.ArgCount {
+    msg := fmt.Sprintf("%s has %d placeholders but is passed %d args", queryLabel(q), argCount, q.ArgCount)
+    if hasNamedPlaceholders(q.Query) {
+      msg = fmt.Sprintf("%s has named placeholders but is passed %d args instead of one map", queryLabel(q), q.ArgCount)
+    }
+    return q.Diagnostic(gen.SeverityError, "sql-args", msg)
+  }
+  if !explain {
+    return nil
+  }
+  rr, err := db.Query(d.explain + query, make([]interface{}, numInput)...)
+  if err != nil {
+    return q.Diagnostic(gen.SeverityError, "sql", fmt.Sprintf("%s: explain: %v", queryLabel(q), err))
+  }
+  rr.Close()
+  return nil
+}
+
+// queryLabel describes the query for a diagnostic, as "rows query", or for
+// a named query, as "query company_people from queries.sql".
+func queryLabel(q *gen.QueryRef) string {
+  if q.Name != "" {
+    return fmt.Sprintf("%s %s from %s", q.Func, q.Name, q.QueryPath)
+  }
+  return q.Func + " query"
+}
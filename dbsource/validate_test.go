@@ -0,0 +1,58 @@
+package dbsource
+
+import (
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func TestValidateQueries(t *testing.T) {
+  db := testDb(t, ":memory:")
+  queries, err := gen.New("validate", false, nil, nil).ExtractQueries([]string{"testdata/validate"})
+  if err != nil {
+    t.Fatalf("ExtractQueries: %v", err)
+  }
+  if got, want := len(queries), 11; got != want {
+    t.Fatalf("ExtractQueries: got %d queries, want %d", got, want)
+  }
+  for _, explain := range []bool{false, true} {
+    diags := ValidateQueries(db, queries, explain)
+    got := make([]string, len(diags))
+    for i, d := range diags {
+      got[i] = d.String()
+    }
+    want := []string{
+      "testdata/validate/queries.tpl:3:13: error: rows query: no such column: nosuchcolumn (sql)",
+      "testdata/validate/queries.tpl:4:13: error: rows query: no such table: nosuchtable (sql)",
+      "testdata/validate/queries.tpl:5:13: error: rows query: incomplete input (sql)",
+      "testdata/validate/queries.tpl:6:11: error: row query has 2 placeholders but is passed 1 args (sql-args)",
+      "testdata/validate/queries.tpl:10:13: error: rows query has named placeholders but is passed 2 args instead of one map (sql-args)",
+      "testdata/validate/queries.tpl:12:14: error: query bad_column from testdata/validate/validate.sql: no such column: nosuchcolumn (sql)",
+    }
+    if diff := cmp.Diff(want, got); diff != "" {
+      t.Errorf("ValidateQueries explain=%v (-want +got):\n%s", explain, diff)
+    }
+  }
+}
+
+func TestCountPlaceholders(t *testing.T) {
+  tests := []struct{
+    query string
+    want int
+  }{
+    {"select * from t", 0},
+    {"select * from t where a = ? and b = ?", 2},
+    {"select * from t where a = '?' and b = \"?\" and c = ? -- ?", 1},
+    {"select * from t where a = $1 or b = $2 or c = $1", 2},
+    {"select * from t where a = :a and b = @b and c = :a", 2},
+    {"select a::text, @@version from t /* :x */ where b = ?", 1},
+    {"select 'it''s ?' from t where a = ?", 1},
+  }
+  for _, tt := range tests {
+    if got := countPlaceholders(tt.query); got != tt.want {
+      t.Errorf("countPlaceholders(%q): got %d, want %d", tt.query, got, tt.want)
+    }
+  }
+}
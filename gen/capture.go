@@ -0,0 +1,46 @@
+package gen
+
+import (
+  "bytes"
+  htmltemplate "html/template"
+
+  "github.com/golang/glog"
+)
+
+// includeString is like include, but rather than writing the output of the
+// included template, it returns that output as a string, so that the caller
+// can assign it to a variable and use it any number of times.
+// In HTML mode, the output has already been escaped by the included template,
+// so it is returned as template.HTML so that it is not escaped again.
+// The value passed to return by the included template is discarded.
+func (g *Generator) includeString(name string, args ...interface{}) (interface{}, error) {
+  glog.V(2).Infof("gtrepgen.includeString(%s)", name)
+  return g.capture(func(gc *Generator) error {
+    _, err := gc.lenientInclude(name, args...)
+    return err
+  })
+}
+
+// evalTemplateString is like evalTemplate, but returns the output of the
+// template as a string in the same way as includeString.
+func (g *Generator) evalTemplateString(template string, args ...interface{}) (interface{}, error) {
+  glog.V(2).Infof("gtrepgen.evalTemplateString()")
+  return g.capture(func(gc *Generator) error {
+    _, err := gc.lenientEvalTemplate(template, args...)
+    return err
+  })
+}
+
+// capture calls f with a generator that writes to a buffer, and returns
+// the contents of the buffer. In lenient mode, a failed section is captured
+// as its placeholder.
+func (g *Generator) capture(f func(*Generator) error) (interface{}, error) {
+  var b bytes.Buffer
+  if err := f(g.WithWriter(&b)); err != nil {
+    return nil, err
+  }
+  if g.isHTML {
+    return htmltemplate.HTML(b.String()), nil
+  }
+  return b.String(), nil
+}
@@ -0,0 +1,45 @@
+package gen
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/jimmc/gtrepgen/data"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+func TestCapture(t *testing.T) {
+  tplname := "org.jimmc.gtrepgen.capturetest"
+  refdirpaths := []string{"testdata"}
+
+  r := goldenbase.NewTester(tplname)
+  goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+
+  g := New(tplname, false, r.OutW, &data.EmptySource{})
+  if err := g.FromTemplate(refdirpaths, nil); err != nil {
+    t.Fatal(err)
+  }
+
+  goldenbase.FatalIfError(t, r.Assert(), "Assert")
+}
+
+func TestCaptureHTML(t *testing.T) {
+  var b strings.Builder
+  g := New("test", true, &b, &data.EmptySource{})
+  templ := `{{$s := evalTemplateString "<b>{{.}}</b>" "<x>"}}{{$s}}|{{$s}}`
+  if err := g.FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "<b>&lt;x&gt;</b>|<b>&lt;x&gt;</b>"; got != want {
+    t.Errorf("Captured HTML: got %q, want %q", got, want)
+  }
+}
+
+func TestCaptureError(t *testing.T) {
+  var b strings.Builder
+  g := New("test", false, &b, &data.EmptySource{})
+  if err := g.FromString(`{{includeString "org.jimmc.gtrepgen.nosuchtemplate"}}`, nil); err == nil {
+    t.Fatalf("Expected error for missing template")
+  }
+}
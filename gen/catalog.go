@@ -0,0 +1,73 @@
+package gen
+
+import (
+  "fmt"
+  "io/ioutil"
+  "path"
+  "sort"
+  "strings"
+)
+
+/* CatalogEntry describes one template found in a set of reference directories. */
+type CatalogEntry struct {
+  TemplateAttributes
+  Path string
+  // Shadowed holds the paths of templates with the same name in later
+  // reference directories, which are hidden by this one.
+  Shadowed []string
+}
+
+/* ReadCatalog scans all of the given reference directories for templates
+ * and reads the attributes of each. When the same name appears in more
+ * than one directory, the first one is used, as with FindTemplateInDirs,
+ * and the others are listed in its Shadowed field.
+ * Templates with no attributes are included, with nil Attributes.
+ * Errors reading the attributes of a template are returned in its Err field.
+ * The result is sorted by name.
+ */
+func ReadCatalog(refpaths []string) ([]*CatalogEntry, error) {
+  entries := make(map[string]*CatalogEntry)
+  for _, dir := range refpaths {
+    fileinfos, err := ioutil.ReadDir(dir)
+    if err != nil {
+      return nil, fmt.Errorf("reading templates from %s: %v", dir, err)
+    }
+    for _, fileinfo := range fileinfos {
+      fname := fileinfo.Name()
+      if fileinfo.IsDir() || !strings.HasSuffix(fname, templateExtension) {
+        continue
+      }
+      name := strings.TrimSuffix(fname, templateExtension)
+      tplpath := path.Join(dir, fname)
+      if e := entries[name]; e != nil {
+        e.Shadowed = append(e.Shadowed, tplpath)
+        continue
+      }
+      attrs, err := ReadTemplateAttributesFromPath(tplpath)
+      entries[name] = &CatalogEntry{
+        TemplateAttributes: TemplateAttributes{
+          Name: name,
+          Attributes: attrs,
+          Err: err,
+        },
+        Path: tplpath,
+      }
+    }
+  }
+  catalog := make([]*CatalogEntry, 0, len(entries))
+  for _, e := range entries {
+    catalog = append(catalog, e)
+  }
+  sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+  return catalog, nil
+}
+
+/* FindCatalogEntry returns the entry with the given name, or nil. */
+func FindCatalogEntry(catalog []*CatalogEntry, name string) *CatalogEntry {
+  for _, e := range catalog {
+    if e.Name == name {
+      return e
+    }
+  }
+  return nil
+}
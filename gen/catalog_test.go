@@ -0,0 +1,47 @@
+package gen
+
+import (
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+  "github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestReadCatalog(t *testing.T) {
+  catalog, err := ReadCatalog([]string{"testdata/catalog1", "testdata/catalog2"})
+  if err != nil {
+    t.Fatalf("Reading catalog: %v", err)
+  }
+  type summary struct {
+    Name string
+    Path string
+    Attributes interface{}
+    HasErr bool
+    Shadowed []string
+  }
+  got := []summary{}
+  for _, e := range catalog {
+    got = append(got, summary{e.Name, e.Path, e.Attributes, e.Err != nil, e.Shadowed})
+  }
+  want := []summary{
+    {"a", "testdata/catalog1/a.tpl", map[string]interface{}{"display": "Report A"}, false,
+        []string{"testdata/catalog2/a.tpl"}},
+    {"b", "testdata/catalog1/b.tpl", nil, false, nil},
+    {"bad", "testdata/catalog2/bad.tpl", nil, true, nil},
+  }
+  if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+    t.Errorf("ReadCatalog() mismatch (-want +got):\n%s", diff)
+  }
+  if e := FindCatalogEntry(catalog, "b"); e == nil || e.Path != "testdata/catalog1/b.tpl" {
+    t.Errorf("FindCatalogEntry(b) got %+v", e)
+  }
+  if e := FindCatalogEntry(catalog, "nosuch"); e != nil {
+    t.Errorf("FindCatalogEntry(nosuch) got %+v, want nil", e)
+  }
+}
+
+func TestReadCatalogMissingDir(t *testing.T) {
+  if _, err := ReadCatalog([]string{"testdata/nosuchdir"}); err == nil {
+    t.Fatalf("Expected error for missing directory")
+  }
+}
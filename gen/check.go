@@ -0,0 +1,436 @@
+package gen
+
+/* This file contains a static checker for the templates in a set of
+ * reference directories. It finds problems that would otherwise only be
+ * found when a report is run:
+ *   - GT attributes that are not valid JSON, or invalid param declarations
+ *   - template syntax errors and calls to unknown functions
+ *   - include of a literal template name that can't be found
+ *   - query or queryRow of a literal query name that can't be found
+ *   - named args to include that don't match the params of the included template
+ *   - {{template "x"}} of a template that is not defined in the file
+ *   - declared params that are not used by the template
+ *   - templates that are not reports (have no attributes) and are not included
+ *     by any other template; this check is skipped if any template calls
+ *     include with a name that is not a literal string
+ */
+
+import (
+  "fmt"
+  "io/ioutil"
+  "sort"
+  "strconv"
+  "strings"
+  texttemplate "text/template"
+  "text/template/parse"
+)
+
+// Severities of a Diagnostic.
+const (
+  SeverityError = "error"
+  SeverityWarning = "warning"
+)
+
+// Diagnostic describes one problem found by Check.
+type Diagnostic struct {
+  Path string `json:"path"`
+  Line int `json:"line,omitempty"`
+  Col int `json:"col,omitempty"`
+  Severity string `json:"severity"`
+  Code string `json:"code"`
+  Message string `json:"message"`
+}
+
+// String returns the diagnostic in the form path:line:col: severity: message (code).
+func (d *Diagnostic) String() string {
+  loc := d.Path
+  if d.Line > 0 {
+    loc += ":" + strconv.Itoa(d.Line)
+    if d.Col > 0 {
+      loc += ":" + strconv.Itoa(d.Col)
+    }
+  }
+  return fmt.Sprintf("%s: %s: %s (%s)", loc, d.Severity, d.Message, d.Code)
+}
+
+// checkedTemplate holds what we learn about one template while checking it.
+type checkedTemplate struct {
+  entry *CatalogEntry
+  params []*Param
+  trees []*parse.Tree
+  includes []string     // Literal names of included templates.
+}
+
+// checker holds the state for one run of Check.
+type checker struct {
+  refpaths []string
+  funcs []map[string]interface{}
+  templates map[string]*checkedTemplate
+  diags []*Diagnostic
+  dynamicInclude bool   // True if any include has a name that is not a literal.
+}
+
+// Check parses all of the templates in the refpaths using the functions
+// available to this generator, including those set by WithFuncs, and returns
+// the problems it finds, sorted by path and location.
+// The error return is for problems reading the refpaths.
+func (g *Generator) Check(refpaths []string) ([]*Diagnostic, error) {
+  catalog, err := ReadCatalog(refpaths)
+  if err != nil {
+    return nil, err
+  }
+  c := &checker{
+    refpaths: refpaths,
+    funcs: g.checkFuncs(),
+    templates: make(map[string]*checkedTemplate),
+  }
+  for _, e := range catalog {
+    c.templates[e.Name] = &checkedTemplate{entry: e}
+  }
+  for _, e := range catalog {
+    c.parseTemplate(c.templates[e.Name])
+  }
+  for _, e := range catalog {
+    c.checkTemplate(c.templates[e.Name])
+  }
+  if !c.dynamicInclude {
+    c.checkReachable()
+  }
+  SortDiagnostics(c.diags)
+  return c.diags, nil
+}
+
+// SortDiagnostics sorts diagnostics by path and location.
+func SortDiagnostics(diags []*Diagnostic) {
+  sort.SliceStable(diags, func(i, j int) bool {
+    a, b := diags[i], diags[j]
+    if a.Path != b.Path {
+      return a.Path < b.Path
+    }
+    if a.Line != b.Line {
+      return a.Line < b.Line
+    }
+    return a.Col < b.Col
+  })
+}
+
+func (c *checker) add(path string, line, col int, severity, code, format string, args ...interface{}) {
+  c.diags = append(c.diags, &Diagnostic{
+    Path: path,
+    Line: line,
+    Col: col,
+    Severity: severity,
+    Code: code,
+    Message: fmt.Sprintf(format, args...),
+  })
+}
+
+// addAt adds a diagnostic at the location of a node.
+func (c *checker) addAt(t *checkedTemplate, tree *parse.Tree, node parse.Node, severity, code, format string, args ...interface{}) {
+  location, _ := tree.ErrorContext(node)
+  line, col := parseLineCol(strings.TrimPrefix(location, tree.ParseName + ":"))
+  c.add(t.entry.Path, line, col, severity, code, format, args...)
+}
+
+// parseTemplate reads and parses one template, recording its params and trees.
+func (c *checker) parseTemplate(t *checkedTemplate) {
+  e := t.entry
+  if e.Err != nil {
+    c.add(e.Path, 1, 0, SeverityError, "attributes", "%v", e.Err)
+  } else {
+    var attrs paramsAttributes
+    // The attributes may not be an object, in which case there are no params.
+    if err := ReadTemplateAttributesFromPathInto(e.Path, &attrs); err == nil {
+      if err := ValidateParams(attrs.Params); err != nil {
+        c.add(e.Path, 1, 0, SeverityError, "params", "%v", err)
+      } else {
+        t.params = attrs.Params
+      }
+    }
+  }
+  trees, err := parseTemplateFile(e.Path, c.funcs)
+  if err != nil {
+    msg := strings.TrimPrefix(err.Error(), "template: ")
+    msg = strings.TrimPrefix(msg, e.Path + ":")
+    line, _ := parseLineCol(msg)
+    if i := strings.Index(msg, ": "); line > 0 && i >= 0 {
+      msg = msg[i+2:]
+    }
+    c.add(e.Path, line, 0, SeverityError, "parse", "%s", msg)
+    return
+  }
+  t.trees = trees
+}
+
+// parseTemplateFile parses the template file at tplpath without executing it,
+// and returns the parse trees of the file and of each template it defines.
+// The name of the tree for the file itself is tplpath.
+func parseTemplateFile(tplpath string, funcs []map[string]interface{}) ([]*parse.Tree, error) {
+  b, err := ioutil.ReadFile(tplpath)
+  if err != nil {
+    return nil, err
+  }
+  tpl := texttemplate.New(tplpath)
+  for _, fm := range funcs {
+    tpl = tpl.Funcs(fm)
+  }
+  tpl, err = tpl.Parse(string(b))
+  if err != nil {
+    return nil, err
+  }
+  var trees []*parse.Tree
+  for _, st := range tpl.Templates() {
+    if st.Tree != nil {
+      trees = append(trees, st.Tree)
+    }
+  }
+  sort.Slice(trees, func(i, j int) bool {
+    return trees[i].Name < trees[j].Name
+  })
+  return trees, nil
+}
+
+// checkFuncs returns the FuncMaps to use when parsing templates for g.
+func (g *Generator) checkFuncs() []map[string]interface{} {
+  funcs := []map[string]interface{}{g.funcMap()}
+  if g.funcs != nil {
+    funcs = append(funcs, g.funcs)
+  }
+  return funcs
+}
+
+// checkTemplate looks at the calls and field references in one template.
+func (c *checker) checkTemplate(t *checkedTemplate) {
+  defined := make(map[string]bool)
+  for _, tree := range t.trees {
+    defined[tree.Name] = true
+  }
+  used := make(map[string]bool)
+  for _, tree := range t.trees {
+    walkNodes(tree.Root, func(node parse.Node) {
+      switch n := node.(type) {
+      case *parse.CommandNode:
+        c.checkCommand(t, tree, n)
+      case *parse.TemplateNode:
+        if !defined[n.Name] {
+          c.addAt(t, tree, n, SeverityError, "template-not-defined", "template %q is not defined", n.Name)
+        }
+      case *parse.FieldNode:
+        used[n.Ident[0]] = true
+      case *parse.VariableNode:
+        if len(n.Ident) > 1 {
+          used[n.Ident[1]] = true
+        }
+      case *parse.ChainNode:
+        if len(n.Field) > 0 {
+          used[n.Field[0]] = true
+        }
+      case *parse.StringNode:
+        used[n.Text] = true     // For {{index . "name"}}.
+      }
+    })
+  }
+  if len(t.trees) == 0 {
+    return
+  }
+  for _, p := range t.params {
+    if !used[p.Name] {
+      c.add(t.entry.Path, 1, 0, SeverityWarning, "unused-param", "param %s is declared but not used", p.Name)
+    }
+  }
+}
+
+// checkCommand checks a call to include, includeString, query, queryRow,
+// try or tryOr.
+func (c *checker) checkCommand(t *checkedTemplate, tree *parse.Tree, cmd *parse.CommandNode) {
+  if fname, args, ok := dataCall(cmd); ok && (fname == "query" || fname == "queryRow") {
+    if nameNode, ok := args[0].(*parse.StringNode); ok {
+      if _, err := FindQueryInDirs(nameNode.Text, c.refpaths); err != nil {
+        c.addAt(t, tree, nameNode, SeverityError, "query-not-found", "%s: %v", fname, err)
+      }
+    }
+    return
+  }
+  args, ok := includeCall(cmd)
+  if !ok {
+    return
+  }
+  nameNode, ok := args[0].(*parse.StringNode)
+  if !ok {
+    c.dynamicInclude = true
+    return
+  }
+  name := nameNode.Text
+  t.includes = append(t.includes, name)
+  tplpath, err := FindTemplateInDirs(name, c.refpaths)
+  if err != nil {
+    c.addAt(t, tree, nameNode, SeverityError, "include-not-found", "include of template %q which is not in the refpaths", name)
+    return
+  }
+  callee := c.templates[name]
+  if callee == nil || callee.entry.Path != tplpath || len(callee.params) == 0 {
+    return
+  }
+  c.checkIncludeArgs(t, tree, nameNode, callee, args[1:])
+}
+
+// includeCall returns the args of cmd following the function name if cmd is
+// a call to include or includeString, directly or through try or tryOr,
+// so that the first of the returned args is the name of the template.
+func includeCall(cmd *parse.CommandNode) ([]parse.Node, bool) {
+  if len(cmd.Args) == 0 {
+    return nil, false
+  }
+  ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+  if !ok {
+    return nil, false
+  }
+  args := cmd.Args[1:]
+  switch ident.Ident {
+  case "include", "includeString":
+  case "tryOr":
+    if len(args) < 1 {
+      return nil, false
+    }
+    args = args[1:]
+    fallthrough
+  case "try":
+    if len(args) < 1 {
+      return nil, false
+    }
+    if s, ok := args[0].(*parse.StringNode); !ok || s.Text != "include" {
+      return nil, false
+    }
+    args = args[1:]
+  default:
+    return nil, false
+  }
+  return args, len(args) > 0
+}
+
+// checkIncludeArgs checks named args to include against the params of the included template.
+func (c *checker) checkIncludeArgs(t *checkedTemplate, tree *parse.Tree, node parse.Node, callee *checkedTemplate, args []parse.Node) {
+  if len(args) == 1 {
+    return      // A single arg sets dot, which we can't check.
+  }
+  if len(args)%2 != 0 {
+    c.addAt(t, tree, node, SeverityError, "include-args", "include %s: named args must be in name/value pairs", callee.entry.Name)
+    return
+  }
+  given := make(map[string]bool)
+  for i := 0; i < len(args); i += 2 {
+    s, ok := args[i].(*parse.StringNode)
+    if !ok {
+      return      // Not a literal name, so we can't check.
+    }
+    given[s.Text] = true
+  }
+  declared := make(map[string]bool)
+  for _, p := range callee.params {
+    declared[p.Name] = true
+    if p.Required && !given[p.Name] {
+      c.addAt(t, tree, node, SeverityError, "include-args", "include %s: missing required param %s", callee.entry.Name, p.Name)
+    }
+  }
+  for i := 0; i < len(args); i += 2 {
+    name := args[i].(*parse.StringNode).Text
+    if !declared[name] {
+      c.addAt(t, tree, args[i], SeverityError, "include-args", "include %s: unknown param %s", callee.entry.Name, name)
+    }
+  }
+}
+
+// checkReachable warns about templates that are not reports and are not
+// included by any template that can be reached from a report.
+func (c *checker) checkReachable() {
+  reached := make(map[string]bool)
+  var reach func(name string)
+  reach = func(name string) {
+    t := c.templates[name]
+    if t == nil || reached[name] {
+      return
+    }
+    reached[name] = true
+    for _, inc := range t.includes {
+      reach(inc)
+    }
+  }
+  for name, t := range c.templates {
+    if t.entry.Attributes != nil || t.entry.Err != nil {
+      reach(name)
+    }
+  }
+  for name, t := range c.templates {
+    if !reached[name] {
+      c.add(t.entry.Path, 0, 0, SeverityWarning, "unreachable", "template %s is not a report and is not included by any report", name)
+    }
+  }
+}
+
+// walkNodes calls f for node and every node under it.
+func walkNodes(node parse.Node, f func(parse.Node)) {
+  if node == nil {
+    return
+  }
+  f(node)
+  switch n := node.(type) {
+  case *parse.ListNode:
+    if n == nil {
+      return
+    }
+    for _, child := range n.Nodes {
+      walkNodes(child, f)
+    }
+  case *parse.ActionNode:
+    walkNodes(n.Pipe, f)
+  case *parse.PipeNode:
+    if n == nil {
+      return
+    }
+    for _, v := range n.Decl {
+      walkNodes(v, f)
+    }
+    for _, cmd := range n.Cmds {
+      walkNodes(cmd, f)
+    }
+  case *parse.CommandNode:
+    for _, arg := range n.Args {
+      walkNodes(arg, f)
+    }
+  case *parse.ChainNode:
+    walkNodes(n.Node, f)
+  case *parse.IfNode:
+    walkBranch(&n.BranchNode, f)
+  case *parse.RangeNode:
+    walkBranch(&n.BranchNode, f)
+  case *parse.WithNode:
+    walkBranch(&n.BranchNode, f)
+  case *parse.TemplateNode:
+    walkNodes(n.Pipe, f)
+  }
+}
+
+func walkBranch(n *parse.BranchNode, f func(parse.Node)) {
+  walkNodes(n.Pipe, f)
+  walkNodes(n.List, f)
+  if n.ElseList != nil {
+    walkNodes(n.ElseList, f)
+  }
+}
+
+// parseLineCol parses a string starting with "line:col" or "line".
+func parseLineCol(s string) (int, int) {
+  parts := strings.SplitN(s, ":", 3)
+  line, err := strconv.Atoi(parts[0])
+  if err != nil {
+    return 0, 0
+  }
+  if len(parts) < 2 {
+    return line, 0
+  }
+  col, err := strconv.Atoi(parts[1])
+  if err != nil {
+    return line, 0
+  }
+  return line, col
+}
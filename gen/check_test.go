@@ -0,0 +1,32 @@
+package gen
+
+import (
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+)
+
+func TestCheck(t *testing.T) {
+  diags, err := New("check", false, nil, nil).Check([]string{"testdata/check"})
+  if err != nil {
+    t.Fatalf("Check: unexpected error: %v", err)
+  }
+  got := make([]string, len(diags))
+  for i, d := range diags {
+    got[i] = d.String()
+  }
+  want := []string{
+    "testdata/check/badattrs.tpl:1: error: unmarshalling json for template attributes: invalid character '}' looking for beginning of value (attributes)",
+    "testdata/check/orphan.tpl: warning: template orphan is not a report and is not included by any report (unreachable)",
+    "testdata/check/report.tpl:1: warning: param unused is declared but not used (unused-param)",
+    "testdata/check/report.tpl:10:10: error: include sub: missing required param y (include-args)",
+    "testdata/check/report.tpl:10:22: error: include sub: unknown param bogus (include-args)",
+    `testdata/check/report.tpl:11:10: error: include of template "missing" which is not in the refpaths (include-not-found)`,
+    `testdata/check/report.tpl:12:11: error: template "nodef" is not defined (template-not-defined)`,
+    `testdata/check/report.tpl:13:14: error: query: query "nosuchquery" not found (query-not-found)`,
+    `testdata/check/syntax.tpl:3: error: function "nosuchfunc" not defined (parse)`,
+  }
+  if diff := cmp.Diff(want, got); diff != "" {
+    t.Errorf("Check diagnostics (-want +got):\n%s", diff)
+  }
+}
@@ -0,0 +1,223 @@
+package gen
+
+/* This file contains support for sources that return a data.RowStream from
+ * row or rows. The template gets the channel of the stream, so that it can
+ * range over the rows. A template can't tell us when it stops reading the
+ * channel, as with {{break}}, so we add a call to the pipeline of every range
+ * that notes when it starts reading a stream, and an action after the range
+ * that closes the stream, which releases its query and connection.
+ * Any stream that is still open, such as one that was never ranged over or
+ * whose range failed, is closed at the end of the report run.
+ * It also contains the check of the tables used by the queries of a template
+ * that declares the tables it may use in its GT attributes, as in
+ * "tables": ["company", "person"]. An included template may use only the
+ * tables allowed to the template that includes it.
+ */
+
+import (
+  "fmt"
+  "strings"
+  "text/template/parse"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+// The names of the functions we add to the start and end of every range.
+const (
+  rangeStartFuncName = "_gtrepgenRangeStart"
+  rangeEndFuncName = "_gtrepgenRangeEnd"
+)
+
+// streamRange records a range that is reading a stream.
+type streamRange struct {
+  id int                // Identifies the range node in its template.
+  stream *data.RowStream
+}
+
+// streamed wraps a data function so that a RowStream that it returns is
+// closed when the template is done with it, and the template gets the
+// channel of the stream.
+func (g *Generator) streamed(f func(args ...interface{}) (interface{}, error)) func(args ...interface{}) (interface{}, error) {
+  return func(args ...interface{}) (interface{}, error) {
+    v, err := f(args...)
+    s, ok := v.(*data.RowStream)
+    if !ok || g.run == nil {
+      return v, err
+    }
+    g.run.streams = append(g.run.streams, s)
+    return s.C, err
+  }
+}
+
+// rangeStart is called with the value of the pipeline of each range,
+// and notes the range if the value is the channel of one of our streams.
+func (g *Generator) rangeStart(id int, v interface{}) interface{} {
+  if c, ok := v.(<-chan *data.Row); ok && g.run != nil {
+    for _, s := range g.run.streams {
+      if s.C == c {
+        g.run.ranges = append(g.run.ranges, &streamRange{id: id, stream: s})
+        break
+      }
+    }
+  }
+  return v
+}
+
+// rangeEnd is called after each range, and closes the stream that the
+// range read, if any. Ranges started after it that didn't end, because
+// their section failed in lenient mode, are also ended.
+func (g *Generator) rangeEnd(id int) (string, error) {
+  if g.run == nil {
+    return "", nil
+  }
+  ranges := g.run.ranges
+  for i := len(ranges) - 1; i >= 0; i-- {
+    if ranges[i].id != id {
+      continue
+    }
+    var firstErr error
+    for _, r := range ranges[i:] {
+      if err := g.run.closeStream(r.stream); err != nil && firstErr == nil {
+        firstErr = err
+      }
+    }
+    g.run.ranges = ranges[:i]
+    return "", firstErr
+  }
+  return "", nil
+}
+
+// closeStream closes a stream and forgets it.
+func (r *runState) closeStream(s *data.RowStream) error {
+  for i, open := range r.streams {
+    if open == s {
+      r.streams = append(r.streams[:i], r.streams[i+1:]...)
+      break
+    }
+  }
+  return s.Close()
+}
+
+// closeStreams closes all of the streams still open at the end of the run
+// and returns the first error from reading any of them.
+func (r *runState) closeStreams() error {
+  var firstErr error
+  for _, s := range r.streams {
+    if err := s.Close(); err != nil && firstErr == nil {
+      firstErr = err
+    }
+  }
+  r.streams = nil
+  r.ranges = nil
+  return firstErr
+}
+
+// addRangeEnds modifies the parse tree so that each range passes its value
+// to rangeStart, and is followed by an action that calls rangeEnd.
+// This must be called after parsing and before executing the template.
+func (g *Generator) addRangeEnds(tree *parse.Tree) {
+  if tree == nil || tree.Root == nil || g.run == nil {
+    return
+  }
+  g.addRangeEndsToList(tree, tree.Root)
+}
+
+func (g *Generator) addRangeEndsToList(tree *parse.Tree, list *parse.ListNode) {
+  if list == nil {
+    return
+  }
+  var nodes []parse.Node
+  for _, node := range list.Nodes {
+    nodes = append(nodes, node)
+    switch n := node.(type) {
+    case *parse.IfNode:
+      g.addRangeEndsToList(tree, n.List)
+      g.addRangeEndsToList(tree, n.ElseList)
+    case *parse.WithNode:
+      g.addRangeEndsToList(tree, n.List)
+      g.addRangeEndsToList(tree, n.ElseList)
+    case *parse.RangeNode:
+      g.addRangeEndsToList(tree, n.List)
+      g.addRangeEndsToList(tree, n.ElseList)
+      g.run.rangeIDs++
+      n.Pipe.Cmds = append(n.Pipe.Cmds, rangeCall(tree, rangeStartFuncName, g.run.rangeIDs, n.Pos))
+      end := rangeCall(tree, rangeEndFuncName, g.run.rangeIDs, n.Pos)
+      pipe := &parse.PipeNode{NodeType: parse.NodePipe, Pos: n.Pos, Line: n.Line, Cmds: []*parse.CommandNode{end}}
+      nodes = append(nodes, &parse.ActionNode{NodeType: parse.NodeAction, Pos: n.Pos, Line: n.Line, Pipe: pipe})
+    }
+  }
+  list.Nodes = nodes
+}
+
+// rangeCall returns a command that calls the named function with the ID of a range.
+func rangeCall(tree *parse.Tree, fname string, id int, pos parse.Pos) *parse.CommandNode {
+  idNode := &parse.NumberNode{NodeType: parse.NodeNumber, Pos: pos, IsInt: true, Int64: int64(id), Text: fmt.Sprint(id)}
+  return &parse.CommandNode{
+    NodeType: parse.NodeCommand,
+    Pos: pos,
+    Args: []parse.Node{parse.NewIdentifier(fname).SetTree(tree).SetPos(pos), idNode},
+  }
+}
+
+// restrictTables returns the tables in both allowed and declared,
+// where a nil allowed means that all tables are allowed.
+func restrictTables(allowed, declared []string) []string {
+  if allowed == nil {
+    return declared
+  }
+  tables := []string{}
+  for _, d := range declared {
+    for _, a := range allowed {
+      if strings.EqualFold(a, d) {
+        tables = append(tables, d)
+        break
+      }
+    }
+  }
+  return tables
+}
+
+// tableCheckedSource is a Source that checks that each query uses only
+// the allowed tables before running it.
+type tableCheckedSource struct {
+  source data.Source
+  tables []string
+}
+
+func (s *tableCheckedSource) check(args []interface{}) error {
+  tc, ok := s.source.(data.TableChecker)
+  if !ok {
+    return fmt.Errorf("the template declares its tables, but a %T can't check them", s.source)
+  }
+  return tc.CheckTables(s.tables, args...)
+}
+
+func (s *tableCheckedSource) Row(args ...interface{}) (interface{}, error) {
+  if err := s.check(args); err != nil {
+    return nil, err
+  }
+  return s.source.Row(args...)
+}
+
+func (s *tableCheckedSource) Rows(args ...interface{}) (interface{}, error) {
+  if err := s.check(args); err != nil {
+    return nil, err
+  }
+  return s.source.Rows(args...)
+}
+
+// noCacheStrippedSource is a Source that removes data.NoCache from the args
+// of each query, for a source that is not a data.CachingSource.
+type noCacheStrippedSource struct {
+  source data.Source
+}
+
+func (s *noCacheStrippedSource) Row(args ...interface{}) (interface{}, error) {
+  args, _ = data.StripNoCache(args)
+  return s.source.Row(args...)
+}
+
+func (s *noCacheStrippedSource) Rows(args ...interface{}) (interface{}, error) {
+  args, _ = data.StripNoCache(args)
+  return s.source.Rows(args...)
+}
@@ -2,6 +2,7 @@ package gen
 
 import (
   "fmt"
+  "strings"
   "testing"
 
   goldenbase "github.com/jimmc/golden/base"
@@ -59,3 +60,15 @@ func TestDataSource(t *testing.T) {
 
   goldenbase.FatalIfError(t, r.Assert(), "Assert")
 }
+
+func TestNoCacheWithoutCachingSource(t *testing.T) {
+  var b strings.Builder
+  g := New("nocache", false, &b, &TestSource{})
+  templ := `{{(row noCache "q1").c}};{{range rows noCache "q2"}}{{.c}};{{end}}{{(queryRow noCache "people").c}}`
+  if err := g.WithRefpaths([]string{"testdata/queries/dir1"}).FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "Three:q1;Three:q2;Thirteen:q2;Twentythree:q2;Three:select * from person"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+}
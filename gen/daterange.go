@@ -0,0 +1,231 @@
+package gen
+
+/* This file contains a parser for relative date expressions such as
+ * "yesterday", "-7d" or "last month", as used for report parameters.
+ * Expressions are resolved relative to a reference time, normally the
+ * report start time, in the location of that reference time.
+ *
+ * A single date expression is one of:
+ *   now                     the reference time itself
+ *   today, yesterday, tomorrow
+ *   [+-]N(h|d|w|m|q|y)      an offset from now in hours, days, weeks,
+ *                           months, quarters or years, e.g. "-7d"
+ *   YYYY-MM-DD              an absolute date
+ *
+ * A date range expression is one of:
+ *   today, yesterday, tomorrow
+ *   (this|last|next) (week|month|quarter|year)
+ *   (week|month|quarter|year) to date, or wtd, mtd, qtd, ytd
+ *   last N (days|weeks|months|quarters|years)
+ *   [+-]N(d|w|m|q|y)        from the start of that day through today
+ *   YYYY, YYYY-MM, YYYY-MM-DD
+ *   A..B                    from the start of day A through the end of day B
+ *
+ * As with the other date functions, the End of a range is exclusive.
+ */
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// DateRange is a half-open range of time from Start up to but not including End.
+// In a template, the two values can be passed to a query as
+// {{rows "... where d >= ? and d < ?" $r.Start $r.End}}.
+type DateRange struct {
+  Start time.Time
+  End time.Time
+}
+
+// String returns the range in a form that ParseDateRange accepts.
+// Since End is exclusive, the last day shown is the day before End.
+func (r *DateRange) String() string {
+  return r.Start.Format(dateLayout) + ".." + r.End.Add(-time.Nanosecond).Format(dateLayout)
+}
+
+const dateLayout = "2006-01-02"
+
+// periodFuncs maps a period name to functions returning the start of that period
+// and moving by a number of periods.
+var periodFuncs = map[string]struct{
+  start func(time.Time) time.Time
+  add func(int, time.Time) time.Time
+}{
+  "day": {startOfDay, addDays},
+  "week": {startOfWeek, func(n int, t time.Time) time.Time { return addDays(7 * n, t) }},
+  "month": {startOfMonth, addMonths},
+  "quarter": {startOfQuarter, func(n int, t time.Time) time.Time { return addMonths(3 * n, t) }},
+  "year": {startOfYear, func(n int, t time.Time) time.Time { return addMonths(12 * n, t) }},
+}
+
+// offsetUnits maps the unit letter of an offset expression to a period name.
+var offsetUnits = map[byte]string{
+  'd': "day",
+  'w': "week",
+  'm': "month",
+  'q': "quarter",
+  'y': "year",
+}
+
+// ParseRelativeDate parses a single date expression relative to ref.
+func ParseRelativeDate(expr string, ref time.Time) (time.Time, error) {
+  e := normalizeDateExpr(expr)
+  switch e {
+  case "now":
+    return ref, nil
+  case "today":
+    return startOfDay(ref), nil
+  case "yesterday":
+    return addDays(-1, startOfDay(ref)), nil
+  case "tomorrow":
+    return addDays(1, startOfDay(ref)), nil
+  }
+  if n, unit, ok := parseOffset(e); ok {
+    if unit == 'h' {
+      return ref.Add(time.Duration(n) * time.Hour), nil
+    }
+    return periodFuncs[offsetUnits[unit]].add(n, ref), nil
+  }
+  if t, err := time.ParseInLocation(dateLayout, e, ref.Location()); err == nil {
+    return t, nil
+  }
+  return time.Time{}, fmt.Errorf("invalid date expression %q", expr)
+}
+
+// ParseDateRange parses a date range expression relative to ref.
+func ParseDateRange(expr string, ref time.Time) (*DateRange, error) {
+  e := normalizeDateExpr(expr)
+  if a, b, ok := strings.Cut(e, ".."); ok {
+    start, err := ParseRelativeDate(a, ref)
+    if err != nil {
+      return nil, fmt.Errorf("invalid start of date range %q: %v", expr, err)
+    }
+    end, err := ParseRelativeDate(b, ref)
+    if err != nil {
+      return nil, fmt.Errorf("invalid end of date range %q: %v", expr, err)
+    }
+    return newDateRange(startOfDay(start), endOfDay(end))
+  }
+  switch e {
+  case "today", "yesterday", "tomorrow":
+    t, _ := ParseRelativeDate(e, ref)
+    return newDateRange(t, endOfDay(t))
+  case "wtd", "mtd", "qtd", "ytd":
+    e = map[string]string{"w":"week", "m":"month", "q":"quarter", "y":"year"}[e[:1]] + " to date"
+  }
+  words := strings.Fields(e)
+  switch {
+  case len(words) == 2 && (words[0] == "this" || words[0] == "last" || words[0] == "next"):
+    p, ok := periodFuncs[words[1]]
+    if !ok {
+      break
+    }
+    n := map[string]int{"this": 0, "last": -1, "next": 1}[words[0]]
+    start := p.add(n, p.start(ref))
+    return newDateRange(start, p.add(1, start))
+  case len(words) == 3 && words[1] == "to" && words[2] == "date":
+    p, ok := periodFuncs[words[0]]
+    if !ok {
+      break
+    }
+    return newDateRange(p.start(ref), endOfDay(ref))
+  case len(words) == 3 && words[0] == "last":
+    n, err := strconv.Atoi(words[1])
+    p, ok := periodFuncs[strings.TrimSuffix(words[2], "s")]
+    if err != nil || n < 1 || !ok {
+      break
+    }
+    end := p.start(ref)
+    return newDateRange(p.add(-n, end), end)
+  }
+  if n, unit, ok := parseOffset(e); ok && unit != 'h' {
+    t := periodFuncs[offsetUnits[unit]].add(n, ref)
+    if n < 0 {
+      return newDateRange(startOfDay(t), endOfDay(ref))
+    }
+    return newDateRange(startOfDay(ref), endOfDay(t))
+  }
+  loc := ref.Location()
+  if t, err := time.ParseInLocation(dateLayout, e, loc); err == nil {
+    return newDateRange(t, endOfDay(t))
+  }
+  if t, err := time.ParseInLocation("2006-01", e, loc); err == nil {
+    return newDateRange(t, endOfMonth(t))
+  }
+  if t, err := time.ParseInLocation("2006", e, loc); err == nil {
+    return newDateRange(t, endOfYear(t))
+  }
+  return nil, fmt.Errorf("invalid date range expression %q", expr)
+}
+
+// newDateRange returns a DateRange, or an error if the range is backwards.
+func newDateRange(start, end time.Time) (*DateRange, error) {
+  if end.Before(start) {
+    return nil, fmt.Errorf("date range end %s is before start %s",
+        end.Format(dateLayout), start.Format(dateLayout))
+  }
+  return &DateRange{Start: start, End: end}, nil
+}
+
+// normalizeDateExpr lowercases the expression and collapses whitespace.
+func normalizeDateExpr(expr string) string {
+  return strings.Join(strings.Fields(strings.ToLower(expr)), " ")
+}
+
+// parseOffset parses an offset expression such as "-7d" or "+2w".
+func parseOffset(e string) (int, byte, bool) {
+  if len(e) < 3 || (e[0] != '+' && e[0] != '-') {
+    return 0, 0, false
+  }
+  unit := e[len(e)-1]
+  if _, ok := offsetUnits[unit]; !ok && unit != 'h' {
+    return 0, 0, false
+  }
+  n, err := strconv.Atoi(e[:len(e)-1])
+  if err != nil {
+    return 0, 0, false
+  }
+  return n, unit, true
+}
+
+// dateRange is the template function that parses a date range expression
+// relative to reportStartTime. If given a DateRange, for example from a
+// report parameter that has already been converted, it returns it unchanged.
+func (g *Generator) dateRange(expr interface{}) (*DateRange, error) {
+  switch v := expr.(type) {
+  case *DateRange:
+    return v, nil
+  case DateRange:
+    return &v, nil
+  case string:
+    return ParseDateRange(v, g.reportStartTime())
+  }
+  return nil, fmt.Errorf("dateRange: invalid argument type %T", expr)
+}
+
+// relativeDate is the template function that parses a single date expression
+// relative to reportStartTime. If given a time, it returns it unchanged.
+func (g *Generator) relativeDate(expr interface{}) (time.Time, error) {
+  switch v := expr.(type) {
+  case time.Time:
+    return v, nil
+  case string:
+    return ParseRelativeDate(v, g.reportStartTime())
+  }
+  return time.Time{}, fmt.Errorf("relativeDate: invalid argument type %T", expr)
+}
+
+// DateRange parses a date range expression relative to the current time of the
+// generator's clock, in the report timezone. This can be used to convert report
+// parameters before passing them to the template.
+func (g *Generator) DateRange(expr string) (*DateRange, error) {
+  return ParseDateRange(expr, g.Now())
+}
+
+// RelativeDate parses a single date expression relative to the current time of the
+// generator's clock, in the report timezone.
+func (g *Generator) RelativeDate(expr string) (time.Time, error) {
+  return ParseRelativeDate(expr, g.Now())
+}
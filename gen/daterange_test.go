@@ -0,0 +1,94 @@
+package gen
+
+import (
+  "testing"
+  "time"
+)
+
+func TestParseRelativeDate(t *testing.T) {
+  ref := mustParseDate(t, "2019-02-14 10:30")
+  tests := []struct{
+    expr string
+    want string
+  }{
+    {"now", "2019-02-14 10:30"},
+    {"Today", "2019-02-14 00:00"},
+    {"yesterday", "2019-02-13 00:00"},
+    {"tomorrow", "2019-02-15 00:00"},
+    {"-7d", "2019-02-07 10:30"},
+    {"+2w", "2019-02-28 10:30"},
+    {"-1m", "2019-01-14 10:30"},
+    {"-1q", "2018-11-14 10:30"},
+    {"+1y", "2020-02-14 10:30"},
+    {"-3h", "2019-02-14 07:30"},
+    {"2018-12-25", "2018-12-25 00:00"},
+  }
+  for _, tt := range tests {
+    got, err := ParseRelativeDate(tt.expr, ref)
+    if err != nil {
+      t.Errorf("ParseRelativeDate(%q): unexpected error: %v", tt.expr, err)
+      continue
+    }
+    if s := got.Format("2006-01-02 15:04"); s != tt.want {
+      t.Errorf("ParseRelativeDate(%q): got %s, want %s", tt.expr, s, tt.want)
+    }
+  }
+}
+
+func TestParseDateRange(t *testing.T) {
+  ref := mustParseDate(t, "2019-02-14 10:30")       // A Thursday.
+  tests := []struct{
+    expr string
+    want string
+  }{
+    {"today", "2019-02-14..2019-02-14"},
+    {"yesterday", "2019-02-13..2019-02-13"},
+    {"this week", "2019-02-11..2019-02-17"},
+    {"last week", "2019-02-04..2019-02-10"},
+    {"next month", "2019-03-01..2019-03-31"},
+    {"Last  Month", "2019-01-01..2019-01-31"},
+    {"last quarter", "2018-10-01..2018-12-31"},
+    {"this year", "2019-01-01..2019-12-31"},
+    {"month to date", "2019-02-01..2019-02-14"},
+    {"qtd", "2019-01-01..2019-02-14"},
+    {"last 7 days", "2019-02-07..2019-02-13"},
+    {"last 2 months", "2018-12-01..2019-01-31"},
+    {"-7d", "2019-02-07..2019-02-14"},
+    {"+1w", "2019-02-14..2019-02-21"},
+    {"2018", "2018-01-01..2018-12-31"},
+    {"2018-02", "2018-02-01..2018-02-28"},
+    {"2018-02-03", "2018-02-03..2018-02-03"},
+    {"2018-12-25..yesterday", "2018-12-25..2019-02-13"},
+  }
+  for _, tt := range tests {
+    got, err := ParseDateRange(tt.expr, ref)
+    if err != nil {
+      t.Errorf("ParseDateRange(%q): unexpected error: %v", tt.expr, err)
+      continue
+    }
+    if s := got.String(); s != tt.want {
+      t.Errorf("ParseDateRange(%q): got %s, want %s", tt.expr, s, tt.want)
+    }
+  }
+}
+
+func TestParseDateRangeErrors(t *testing.T) {
+  ref := mustParseDate(t, "2019-02-14 10:30")
+  for _, expr := range []string{"", "last", "last fortnight", "last 0 days", "-3h", "7d", "2019-13", "today..2019-01-01"} {
+    if _, err := ParseDateRange(expr, ref); err == nil {
+      t.Errorf("ParseDateRange(%q): expected error", expr)
+    }
+  }
+}
+
+func TestDateRangeInLocation(t *testing.T) {
+  loc := time.FixedZone("UTC-8", -8*60*60)
+  ref := mustParseDate(t, "2019-03-01 03:00").In(loc)
+  got, err := ParseDateRange("this month", ref)
+  if err != nil {
+    t.Fatalf("ParseDateRange: unexpected error: %v", err)
+  }
+  if got, want := got.Start.Format(time.RFC3339), "2019-02-01T00:00:00-08:00"; got != want {
+    t.Errorf("Start in location: got %s, want %s", got, want)
+  }
+}
@@ -0,0 +1,116 @@
+package gen
+
+/* This file contains date arithmetic functions for use in templates.
+ * All calculations are done in the location of the time passed in,
+ * so a time from reportStartTime is handled in the report timezone.
+ * The end of a period is the start of the following period, so a
+ * period can be used directly in a query as ">= start and < end".
+ */
+
+import (
+  "time"
+)
+
+// dateFuncs are added to the FuncMap of every template.
+var dateFuncs = map[string]interface{}{
+  "addDays": addDays,
+  "addMonths": addMonths,
+  "daysBetween": daysBetween,
+  "startOfDay": startOfDay,
+  "endOfDay": endOfDay,
+  "startOfWeek": startOfWeek,
+  "endOfWeek": endOfWeek,
+  "startOfMonth": startOfMonth,
+  "endOfMonth": endOfMonth,
+  "startOfQuarter": startOfQuarter,
+  "endOfQuarter": endOfQuarter,
+  "startOfYear": startOfYear,
+  "endOfYear": endOfYear,
+}
+
+// addDays adds n calendar days to t, keeping the same clock time.
+func addDays(n int, t time.Time) time.Time {
+  return t.AddDate(0, 0, n)
+}
+
+// addMonths adds n months to t. If the resulting month is shorter than the day
+// of the month of t, the result is the last day of that month, so that adding
+// one month to Jan 31 gives Feb 28 (or 29) rather than a day in March.
+func addMonths(n int, t time.Time) time.Time {
+  y, m, d := t.Date()
+  first := time.Date(y, m + time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+  if last := daysInMonth(first); d > last {
+    d = last
+  }
+  return first.AddDate(0, 0, d - 1)
+}
+
+// daysBetween returns the number of calendar days from a to b, which is
+// negative if b is before a. Both dates are taken in the location of a.
+func daysBetween(a, b time.Time) int {
+  ay, am, ad := a.Date()
+  by, bm, bd := b.In(a.Location()).Date()
+  ua := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+  ub := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+  return int(ub.Sub(ua).Hours() / 24)
+}
+
+// startOfDay returns midnight at the start of the day of t.
+func startOfDay(t time.Time) time.Time {
+  y, m, d := t.Date()
+  return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// endOfDay returns midnight at the start of the day after t.
+func endOfDay(t time.Time) time.Time {
+  return startOfDay(t).AddDate(0, 0, 1)
+}
+
+// startOfWeek returns midnight at the start of the Monday on or before t.
+func startOfWeek(t time.Time) time.Time {
+  offset := (int(t.Weekday()) + 6) % 7      // Days since Monday.
+  return startOfDay(t).AddDate(0, 0, -offset)
+}
+
+// endOfWeek returns midnight at the start of the Monday after t.
+func endOfWeek(t time.Time) time.Time {
+  return startOfWeek(t).AddDate(0, 0, 7)
+}
+
+// startOfMonth returns midnight at the start of the first day of the month of t.
+func startOfMonth(t time.Time) time.Time {
+  y, m, _ := t.Date()
+  return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
+
+// endOfMonth returns midnight at the start of the first day of the month after t.
+func endOfMonth(t time.Time) time.Time {
+  return startOfMonth(t).AddDate(0, 1, 0)
+}
+
+// startOfQuarter returns midnight at the start of the calendar quarter of t.
+func startOfQuarter(t time.Time) time.Time {
+  y, m, _ := t.Date()
+  m = m - (m - 1) % 3
+  return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
+
+// endOfQuarter returns midnight at the start of the calendar quarter after t.
+func endOfQuarter(t time.Time) time.Time {
+  return startOfQuarter(t).AddDate(0, 3, 0)
+}
+
+// startOfYear returns midnight at the start of Jan 1 of the year of t.
+func startOfYear(t time.Time) time.Time {
+  return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+}
+
+// endOfYear returns midnight at the start of Jan 1 of the year after t.
+func endOfYear(t time.Time) time.Time {
+  return startOfYear(t).AddDate(1, 0, 0)
+}
+
+// daysInMonth returns the number of days in the month of t.
+func daysInMonth(t time.Time) int {
+  return endOfMonth(t).AddDate(0, 0, -1).Day()
+}
@@ -0,0 +1,64 @@
+package gen
+
+import (
+  "testing"
+  "time"
+)
+
+func mustParseDate(t *testing.T, s string) time.Time {
+  t.Helper()
+  d, err := time.Parse("2006-01-02 15:04", s)
+  if err != nil {
+    t.Fatalf("Error parsing test time %q: %v", s, err)
+  }
+  return d
+}
+
+func TestDateFuncs(t *testing.T) {
+  base := mustParseDate(t, "2019-02-14 10:30")       // A Thursday.
+  tests := []struct{
+    name string
+    got time.Time
+    want string
+  }{
+    {"addDays", addDays(-14, base), "2019-01-31 10:30"},
+    {"addMonths", addMonths(1, base), "2019-03-14 10:30"},
+    {"addMonthsClamp", addMonths(1, mustParseDate(t, "2020-01-31 08:00")), "2020-02-29 08:00"},
+    {"addMonthsBack", addMonths(-3, mustParseDate(t, "2019-05-31 08:00")), "2019-02-28 08:00"},
+    {"startOfDay", startOfDay(base), "2019-02-14 00:00"},
+    {"endOfDay", endOfDay(base), "2019-02-15 00:00"},
+    {"startOfWeek", startOfWeek(base), "2019-02-11 00:00"},
+    {"startOfWeekSunday", startOfWeek(mustParseDate(t, "2019-02-17 09:00")), "2019-02-11 00:00"},
+    {"endOfWeek", endOfWeek(base), "2019-02-18 00:00"},
+    {"startOfMonth", startOfMonth(base), "2019-02-01 00:00"},
+    {"endOfMonth", endOfMonth(base), "2019-03-01 00:00"},
+    {"startOfQuarter", startOfQuarter(base), "2019-01-01 00:00"},
+    {"endOfQuarter", endOfQuarter(mustParseDate(t, "2019-12-31 23:00")), "2020-01-01 00:00"},
+    {"startOfYear", startOfYear(base), "2019-01-01 00:00"},
+    {"endOfYear", endOfYear(base), "2020-01-01 00:00"},
+  }
+  for _, tt := range tests {
+    if got := tt.got.Format("2006-01-02 15:04"); got != tt.want {
+      t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+    }
+  }
+}
+
+func TestDaysBetween(t *testing.T) {
+  a := mustParseDate(t, "2019-02-14 23:30")
+  b := mustParseDate(t, "2019-03-01 00:10")
+  if got, want := daysBetween(a, b), 15; got != want {
+    t.Errorf("daysBetween got %d, want %d", got, want)
+  }
+  if got, want := daysBetween(b, a), -15; got != want {
+    t.Errorf("daysBetween reversed got %d, want %d", got, want)
+  }
+}
+
+func TestStartOfDayInLocation(t *testing.T) {
+  loc := time.FixedZone("UTC-8", -8*60*60)
+  utc := mustParseDate(t, "2019-02-14 03:00")
+  if got, want := startOfDay(utc.In(loc)).Format(time.RFC3339), "2019-02-13T00:00:00-08:00"; got != want {
+    t.Errorf("startOfDay in location got %s, want %s", got, want)
+  }
+}
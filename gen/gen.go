@@ -1,6 +1,7 @@
 package gen
 
 import (
+  "encoding/json"
   "fmt"
   htmltemplate "html/template"
   "io"
@@ -17,9 +18,6 @@ import (
 
 const templateExtension = ".tpl"
 
-// Now returns the current time. You can provide your own Now function for testing.
-var Now = time.Now
-
 // Generator provides a type that can generate output from either text or HTML templates
 // from a literal string, a specific file path, or a named file from a reference directory.
 type Generator struct {
@@ -29,9 +27,33 @@ type Generator struct {
   isHTML bool
   refpaths []string
   funcs map[string]interface{}
+  now func() time.Time          // The clock used for reportStartTime.
+  timer func() time.Time        // The clock used to measure how long things take.
+  location *time.Location       // If set, times are converted to this zone.
+  strict bool                   // If true, missing keys and printing nil are errors.
+  lenient bool                  // If true, failed sections are replaced by a placeholder.
+  onRead func(tplpath string)   // If set, called for each template file we read.
+  stats *RunStats               // If set, filled in for each run.
+  statsAppendix bool            // If true, the stats are written at the end of the report.
+  observer Observer             // If set, receives the events of each run.
+  tables []string               // If not nil, the only tables that queries may use.
+  run *runState                 // Set once per report run, shared by includes.
   includeResult interface{}
 }
 
+// runState holds the information for one report run that is shared by the
+// top-level template and all of its includes.
+type runState struct {
+  startTime time.Time
+  errs []error          // Errors from failed sections in lenient mode.
+  stats *RunStats       // If set, we record queries and template times.
+  streams []*data.RowStream     // Streams that are open.
+  ranges []*streamRange         // The ranges that are reading streams, innermost last.
+  rangeIDs int                  // The last ID given to a range, see addRangeEnds.
+  source data.Source    // If set, the source to use for the run, from data.RunSource.
+  queryDirs map[string]*queryDir        // The .sql queries read so far, by directory.
+}
+
 // New creates a Generator.
 func New(name string, isHTML bool, w io.Writer, source data.Source) *Generator {
   glog.V(1).Infof("gtrepgen.New(%s)", name)
@@ -40,59 +62,139 @@ func New(name string, isHTML bool, w io.Writer, source data.Source) *Generator {
     w: w,
     source: source,
     isHTML: isHTML,
+    now: time.Now,
+    timer: time.Now,
   }
 }
 
+// clone returns a copy of the generator.
+func (g *Generator) clone() *Generator {
+  gc := *g
+  return &gc
+}
+
 // Create a copy of a generator with a changed name.
 func (g *Generator) WithName(name string) *Generator {
   glog.V(1).Infof("gtrepgen.WithName(%s) from name %s", name, g.name)
-  return &Generator{
-    name: name,
-    w: g.w,
-    source: g.source,
-    isHTML: g.isHTML,
-    refpaths: g.refpaths,
-    funcs: g.funcs,
-  }
+  gc := g.clone()
+  gc.name = name
+  return gc
 }
 
 // Create a copy of a generator with a changed refpaths.
 func (g *Generator) WithRefpaths(refpaths []string) *Generator {
   glog.V(1).Infof("gtrepgen.WithRefpaths(%v) from name %s", refpaths, g.name)
-  return &Generator{
-    name: g.name,
-    w: g.w,
-    source: g.source,
-    isHTML: g.isHTML,
-    refpaths: refpaths,
-    funcs: g.funcs,
-  }
+  gc := g.clone()
+  gc.refpaths = refpaths
+  return gc
 }
 
 // Create a copy of a generator with a changed funcs.
 func (g *Generator) WithFuncs(funcs map[string]interface{}) *Generator {
   glog.V(1).Infof("gtrepgen.WithFuncs() from name %s", g.name)
-  return &Generator{
-    name: g.name,
-    w: g.w,
-    source: g.source,
-    isHTML: g.isHTML,
-    refpaths: g.refpaths,
-    funcs: funcs,
+  gc := g.clone()
+  gc.funcs = funcs
+  return gc
+}
+
+// Create a copy of a generator with a changed writer.
+func (g *Generator) WithWriter(w io.Writer) *Generator {
+  gc := g.clone()
+  gc.w = w
+  return gc
+}
+
+// Create a copy of a generator that calls onRead with the path of each
+// template file that it reads, including those read by include.
+// This allows a caller to find all of the files that a report depends on.
+func (g *Generator) WithOnRead(onRead func(tplpath string)) *Generator {
+  glog.V(1).Infof("gtrepgen.WithOnRead() from name %s", g.name)
+  gc := g.clone()
+  gc.onRead = onRead
+  return gc
+}
+
+// Create a copy of a generator with a changed clock. The clock is called once
+// at the start of each report to provide the value of reportStartTime.
+// This allows tests, or a server rendering reports "as of" a given time,
+// to run without changing any global state. A nil clock means time.Now.
+// Durations are measured with the timer instead, see WithTimer.
+func (g *Generator) WithClock(now func() time.Time) *Generator {
+  glog.V(1).Infof("gtrepgen.WithClock() from name %s", g.name)
+  gc := g.clone()
+  if now == nil {
+    now = time.Now
+  }
+  gc.now = now
+  return gc
+}
+
+// Create a copy of a generator with a changed timing clock, which is used
+// to measure the durations in RunStats and the times of Events. Unlike the
+// clock of WithClock, it should tell the real time. A nil timer means time.Now.
+func (g *Generator) WithTimer(timer func() time.Time) *Generator {
+  glog.V(1).Infof("gtrepgen.WithTimer() from name %s", g.name)
+  gc := g.clone()
+  if timer == nil {
+    timer = time.Now
+  }
+  gc.timer = timer
+  return gc
+}
+
+// Create a copy of a generator with a changed report timezone.
+// The reportStartTime and formatTime template functions convert
+// times to this location. A nil location leaves times unchanged.
+func (g *Generator) WithLocation(location *time.Location) *Generator {
+  glog.V(1).Infof("gtrepgen.WithLocation(%v) from name %s", location, g.name)
+  gc := g.clone()
+  gc.location = location
+  return gc
+}
+
+// reportStartTime returns the time at which the current report started,
+// in the report timezone. Included templates see the same value.
+func (g *Generator) reportStartTime() time.Time {
+  return g.inLocation(g.run.startTime)
+}
+
+// formatTime converts the time to the report timezone and passes the args
+// through to time.Format.
+func (g *Generator) formatTime(format string, t time.Time) string {
+  return formatTime(format, g.inLocation(t))
+}
+
+// Now returns the current time from the generator's clock in the report timezone.
+func (g *Generator) Now() time.Time {
+  return g.inLocation(g.now())
+}
+
+// inLocation converts the time to the report timezone, if we have one.
+func (g *Generator) inLocation(t time.Time) time.Time {
+  if g.location == nil {
+    return t
   }
+  return t.In(g.location)
 }
 
 // include allows us to include another template from our reference directory.
-// Args is either no args or a single arg that sets dot.
+// Args is either no args, a single arg that sets dot, or pairs of names and
+// values that set dot to a map[string]interface{}, as in
+// {{include "company" "id" .companyid "title" "Summary"}}.
+// If the included template declares params, those named values are checked
+// against them, see ApplyParams.
 func (g *Generator) include(name string, args ...interface{}) (interface{}, error) {
   glog.V(2).Infof("gtrepgen.include(%s)", name)
   tplpath, err := g.FindTemplate(name)
   if err != nil {
-    return nil, fmt.Errorf("template %s: %v", name, err)
+    return nil, fmt.Errorf("include from %s: %v", g.name, err)
   }
   var dot interface{}
   if len(args) > 1 {
-    return nil, fmt.Errorf("too many args (%d) for Generator.template", len(args))
+    dot, err = namedArgs(args)
+    if err != nil {
+      return nil, fmt.Errorf("include %s from %s: %v", name, g.name, err)
+    }
   } else if len(args) == 0 {
     dot = nil
   } else {
@@ -100,8 +202,11 @@ func (g *Generator) include(name string, args ...interface{}) (interface{}, erro
   }
   gInclude := g.WithName(name)
   gInclude.includeResult = ""
-  if err := gInclude.FromPath(tplpath, dot); err != nil {
-    return nil, err
+  g.notify(&Event{Kind: EventIncludeEnter, Name: name, Path: tplpath})
+  err = gInclude.FromPath(tplpath, dot)
+  g.notify(&Event{Kind: EventIncludeExit, Name: name, Path: tplpath, Err: err})
+  if err != nil {
+    return nil, fmt.Errorf("include %s from %s: %v", name, g.name, err)
   }
   return gInclude.includeResult, nil
 }
@@ -120,7 +225,10 @@ func (g *Generator) evalTemplate(template string, args ...interface{}) (interfac
   }
   gInclude := g.WithName("evalTemplate")
   gInclude.includeResult = ""
-  if err := gInclude.FromString(template, dot); err != nil {
+  g.notify(&Event{Kind: EventEvalTemplateEnter})
+  err := gInclude.FromString(template, dot)
+  g.notify(&Event{Kind: EventEvalTemplateExit, Err: err})
+  if err != nil {
     return nil, err
   }
   return gInclude.includeResult, nil
@@ -130,7 +238,8 @@ func (g *Generator) evalTemplate(template string, args ...interface{}) (interfac
 // the including template. If the included template does not invoke return, then the
 // return value of the include statement is the empty string.
 // (A return value of nil causes the string "<no value>" to appear in the output when the
-// include statement is called without assigning the output in the caller.)
+// include statement is called without assigning the output in the caller,
+// or an error in strict mode.)
 // The value of the return expression itself is the empty string.
 func (g *Generator) includeReturn(returnVal interface{}) (interface{}, error) {
   g.includeResult = returnVal
@@ -146,10 +255,19 @@ func (g *Generator) htmlFromString(templ string, dot interface{}, fm map[string]
   if g.funcs != nil {
     tpl = tpl.Funcs(g.funcs)
   }
+  if g.strict {
+    tpl = tpl.Option("missingkey=error")
+  }
   tpl, err := tpl.Parse(templ)
   if err != nil {
     return fmt.Errorf("parsing html template %s: %v", g.name, err)
   }
+  for _, t := range tpl.Templates() {
+    if g.strict {
+      addStrictChecks(t.Tree)
+    }
+    g.addRangeEnds(t.Tree)
+  }
   if err := tpl.Execute(g.w, dot); err != nil {
     return fmt.Errorf("executing html template %s: %v", g.name, err)
   }
@@ -165,31 +283,136 @@ func (g *Generator) textFromString(templ string, dot interface{},fm map[string]i
   if g.funcs != nil {
     tpl = tpl.Funcs(g.funcs)
   }
+  if g.strict {
+    tpl = tpl.Option("missingkey=error")
+  }
   tpl, err := tpl.Parse(templ)
   if err != nil {
     return fmt.Errorf("parsing text template %s: %v", g.name, err)
   }
+  for _, t := range tpl.Templates() {
+    if g.strict {
+      addStrictChecks(t.Tree)
+    }
+    g.addRangeEnds(t.Tree)
+  }
   if err := tpl.Execute(g.w, dot); err != nil {
     return fmt.Errorf("executing text template %s: %v", g.name, err)
   }
   return nil
 }
 
+// generatorAttributes are the GT attributes that the Generator itself looks at.
+type generatorAttributes struct {
+  Strict *bool
+  Params []*Param
+  Tables []string
+}
+
+// readGeneratorAttributes reads the GT attributes of the template that we care about.
+// Attributes that can't be read as an object are left for the application,
+// but it is an error for an object to have one of our fields with the wrong type.
+func readGeneratorAttributes(templ string) (*generatorAttributes, error) {
+  var raw json.RawMessage
+  if err := ReadTemplateAttributesFromStringInto(templ, &raw); err != nil || raw == nil {
+    if err != nil {
+      glog.V(1).Infof("gtrepgen: ignoring template attributes: %v", err)
+    }
+    return &generatorAttributes{}, nil
+  }
+  var obj map[string]json.RawMessage
+  if err := json.Unmarshal(raw, &obj); err != nil {
+    glog.V(1).Infof("gtrepgen: ignoring template attributes that are not an object: %v", err)
+    return &generatorAttributes{}, nil
+  }
+  var attrs generatorAttributes
+  if err := json.Unmarshal(raw, &attrs); err != nil {
+    return nil, fmt.Errorf("reading template attributes: %v", err)
+  }
+  return &attrs, nil
+}
+
 // FromString executes the given literal template with the specified dot value.
+// If the template declares params in its GT attributes and dot is nil or a
+// map[string]interface{}, dot is checked against those params, see ApplyParams.
 func (g *Generator) FromString(templ string, dot interface{}) error {
-  now := Now()
-  startTime := func() time.Time { return now }
-  fm := map[string]interface{}{  // fm is a (texttemplate|htmltemplate).FuncMap
-    "include": g.include,
-    "evalTemplate": g.evalTemplate,
-    "evenodd": evenodd,
-    "formatTime": formatTime,
-    "mkmap": mkmap,
-    "reportStartTime": startTime,
-    "return": g.includeReturn,
-    "row": g.source.Row,
-    "rows": g.source.Rows,
+  attrs, err := readGeneratorAttributes(templ)
+  if err != nil {
+    return fmt.Errorf("template %s: %v", g.name, err)
+  }
+  gRun := g.clone()
+  if attrs.Strict != nil {
+    gRun.strict = *attrs.Strict
+  }
+  if attrs.Tables != nil {
+    gRun.tables = restrictTables(gRun.tables, attrs.Tables)
+  }
+  if gRun.run != nil {
+    err := gRun.fromString(templ, attrs, dot)
+    g.includeResult = gRun.includeResult
+    return err
+  }
+  // This is the top level of a report, set up the state for it and all of its includes.
+  startTime := gRun.Now()
+  gRun.run = &runState{
+    startTime: startTime,
+    stats: gRun.startStats(gRun.timer()),
+  }
+  gRun.notify(&Event{Kind: EventRenderStart})
+  var endRun func(err error) error
+  if rs, ok := gRun.source.(data.RunSource); ok {
+    source, end, err := rs.BeginRun()
+    if err != nil {
+      err = fmt.Errorf("template %s: starting run: %v", g.name, err)
+      gRun.notify(&Event{Kind: EventRenderEnd, Err: err})
+      return err
+    }
+    gRun.run.source = source
+    endRun = end
+  }
+  err = gRun.fromString(templ, attrs, dot)
+  g.includeResult = gRun.includeResult
+  if closeErr := gRun.run.closeStreams(); err == nil && closeErr != nil {
+    err = fmt.Errorf("template %s: %v", g.name, closeErr)
+  }
+  if err == nil {
+    if stats := gRun.run.stats; stats != nil {
+      stats.Duration = gRun.timer().Sub(stats.Start)
+      if gRun.statsAppendix {
+        err = stats.writeAppendix(gRun.w, gRun.isHTML)
+      }
+    }
   }
+  if err == nil && len(gRun.run.errs) > 0 {
+    err = &RenderErrors{Name: g.name, Errors: gRun.run.errs}
+  }
+  if endRun != nil {
+    if endErr := endRun(err); err == nil && endErr != nil {
+      err = fmt.Errorf("template %s: ending run: %v", g.name, endErr)
+    }
+  }
+  gRun.notify(&Event{Kind: EventRenderEnd, Err: err})
+  return err
+}
+
+// fromString renders a template within a report run.
+func (g *Generator) fromString(templ string, attrs *generatorAttributes, dot interface{}) error {
+  dot, err := g.applyParams(attrs.Params, dot)
+  if err != nil {
+    return fmt.Errorf("template %s: %v", g.name, err)
+  }
+  start := g.timer()
+  err = g.execute(templ, dot)
+  if stats := g.run.stats; stats != nil {
+    stats.addTemplateTime(g.name, g.timer().Sub(start))
+  }
+  return err
+}
+
+// execute executes the given literal template with the specified dot value
+// using either text/template or html/template.
+func (g *Generator) execute(templ string, dot interface{}) error {
+  fm := g.funcMap()
   if g.isHTML {
     return g.htmlFromString(templ, dot, fm)
   } else {
@@ -197,8 +420,44 @@ func (g *Generator) FromString(templ string, dot interface{}) error {
   }
 }
 
+// funcMap returns the functions that we provide to every template,
+// not including the custom funcs set by WithFuncs.
+func (g *Generator) funcMap() map[string]interface{} {
+  fm := map[string]interface{}{  // fm is a (texttemplate|htmltemplate).FuncMap
+    "dateRange": g.dateRange,
+    "evalTemplate": g.lenientEvalTemplate,
+    "evalTemplateString": g.evalTemplateString,
+    "evenodd": evenodd,
+    "formatTime": g.formatTime,
+    "include": g.lenientInclude,
+    "includeString": g.includeString,
+    "mkmap": mkmap,
+    "noCache": noCache,
+    "query": g.lenientQuery,
+    "queryRow": g.lenientQueryRow,
+    "relativeDate": g.relativeDate,
+    "required": required,
+    "reportStartTime": g.reportStartTime,
+    "return": g.includeReturn,
+    "row": g.lenientRow,
+    "rows": g.lenientRows,
+    "try": g.try,
+    "tryOr": g.tryOr,
+    // Not for use in templates; see addRangeEnds.
+    rangeStartFuncName: g.rangeStart,
+    rangeEndFuncName: g.rangeEnd,
+  }
+  for k, v := range dateFuncs {
+    fm[k] = v
+  }
+  return fm
+}
+
 // FromPath reads a template from the given file path and executes it with the specified dot value.
 func (g *Generator) FromPath(tplpath string, dot interface{}) error {
+  if g.onRead != nil {
+    g.onRead(tplpath)
+  }
   templ, err := ioutil.ReadFile(tplpath)
   if err != nil {
     return fmt.Errorf("reading template file %s: %v", tplpath, err)
@@ -219,7 +478,11 @@ func (g *Generator) FromTemplate(refpaths []string, dot interface{}) error {
 
 // FindTemplate finds the first readable template in the list of reference directories.
 func (g *Generator) FindTemplate(name string) (string, error) {
-  return FindTemplateInDirs(name, g.refpaths)
+  tplpath, err := FindTemplateInDirs(name, g.refpaths)
+  if err == nil {
+    g.notify(&Event{Kind: EventTemplateResolved, Name: name, Path: tplpath})
+  }
+  return tplpath, err
 }
 
 // FindAndReadAttributes finds the template and reads the attributes from it.
@@ -268,6 +531,11 @@ func mkmap(args ...interface{}) (map[interface{}]interface{}, error) {
   return m, nil
 }
 
+// noCache returns the marker that asks a caching source not to cache a query.
+func noCache() interface{} {
+  return data.NoCache
+}
+
 // evenodd returns the second or third arg based on whether the first arg is even or odd.
 func evenodd(n int, evenret, oddret interface{}) interface{} {
   if n % 2 == 0 {
@@ -1,6 +1,8 @@
 package gen
 
 import (
+  "fmt"
+  "strings"
   "testing"
   "time"
 
@@ -25,6 +27,30 @@ func TestFromString(t *testing.T) {
   goldenbase.FatalIfError(t, r.Assert(), "Assert")
 }
 
+func TestAttributeTypes(t *testing.T) {
+  tests := []struct{
+    attrs string
+    wantErr string
+  }{
+    {`"a string"`, ""},
+    {`{"display": "Report", "other": [1]}`, ""},
+    {`{"tables": "pub"}`, "reading template attributes"},
+    {`{"params": {"name": "x"}}`, "reading template attributes"},
+    {`{"strict": "yes"}`, "reading template attributes"},
+  }
+  for _, tt := range tests {
+    templ := "{{/*GT: " + tt.attrs + " */ -}}\nHello"
+    err := New("attrs", false, &strings.Builder{}, &data.EmptySource{}).FromString(templ, nil)
+    if tt.wantErr == "" {
+      if err != nil {
+        t.Errorf("%s: unexpected error: %v", tt.attrs, err)
+      }
+    } else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+      t.Errorf("%s: got error %v, want %q", tt.attrs, err, tt.wantErr)
+    }
+  }
+}
+
 func TestFromPath(t *testing.T) {
   basename := "helloworld"
   dot := "World"
@@ -124,6 +150,56 @@ func TestIncludeTwoDirs(t *testing.T) {
   goldenbase.FatalIfError(t, r.Assert(), "Assert")
 }
 
+func TestClockAndLocation(t *testing.T) {
+  tplname := "org.jimmc.gtrepgen.clocktest"
+  refdirpaths := []string{"testdata"}
+  testTime, err := time.Parse("Jan 2, 2006 15:04:05", "Feb 1, 2019 14:34:20")
+  if err != nil {
+    t.Fatalf("Error parsing test time")
+  }
+  // Each call to the clock advances it, so we can tell that includes use the same start time.
+  clock := func() time.Time {
+    testTime = testTime.Add(time.Hour)
+    return testTime.Add(-time.Hour)
+  }
+  pst := time.FixedZone("PST", -8*60*60)
+
+  r := goldenbase.NewTester(tplname)
+  goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+
+  g := New(tplname, false, r.OutW, &data.EmptySource{}).WithClock(clock).WithLocation(pst)
+  if err := g.FromTemplate(refdirpaths, nil); err != nil {
+    t.Fatal(err)
+  }
+
+  goldenbase.FatalIfError(t, r.Assert(), "Assert")
+
+  // A nil clock is the real clock.
+  var b strings.Builder
+  g = New("nilclock", false, &b, &data.EmptySource{}).WithClock(nil)
+  if err := g.FromString(`{{reportStartTime.Year}}`, nil); err != nil {
+    t.Fatalf("Nil clock: %v", err)
+  }
+  if got, want := b.String(), fmt.Sprint(time.Now().Year()); got != want {
+    t.Errorf("Nil clock: got %q, want %q", got, want)
+  }
+}
+
+func TestOnRead(t *testing.T) {
+  var files []string
+  onRead := func(tplpath string) {
+    files = append(files, tplpath)
+  }
+  var b strings.Builder
+  g := New("inc1", false, &b, &data.EmptySource{}).WithOnRead(onRead)
+  if err := g.FromTemplate([]string{"testdata", "../dbsource/testdata"}, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := strings.Join(files, ","), "testdata/inc1.tpl,../dbsource/testdata/inc2.tpl"; got != want {
+    t.Errorf("Files read: got %s, want %s", got, want)
+  }
+}
+
 func TestEvenOdd(t *testing.T) {
   if got, want := evenodd(0, "a", "b"), "a"; got != want {
     t.Errorf("evenodd got %v, want %v", got, want)
@@ -0,0 +1,237 @@
+package gen
+
+/* This file contains an analysis of the dependencies between the templates
+ * in a set of reference directories, found by walking their parse trees
+ * for calls to include and template with literal names.
+ * Each template file is a node named by its template name. Each template
+ * defined within a file with {{define}} is a separate node named by the
+ * file's template name, a slash, and the defined name, so that we can tell
+ * which includes are used by a {{template}} call.
+ */
+
+import (
+  "encoding/json"
+  "fmt"
+  "io"
+  "sort"
+  "strconv"
+  "strings"
+  "text/template/parse"
+)
+
+// Kinds of GraphEdge.
+const (
+  EdgeInclude = "include"
+  EdgeTemplate = "template"
+)
+
+// GraphNode is one template in a DependencyGraph.
+type GraphNode struct {
+  Name string `json:"name"`
+  // Path is the file of the template, or empty if the template is
+  // included but not found in the refpaths.
+  Path string `json:"path,omitempty"`
+  // File is the name of the node for the file in which this template
+  // is defined, if this is a template defined by {{define}}.
+  File string `json:"file,omitempty"`
+  // Dynamic is true if the template calls include with a name that is not
+  // a literal string, in which case its dependencies are not all known.
+  Dynamic bool `json:"dynamic,omitempty"`
+  Err string `json:"error,omitempty"`
+}
+
+// GraphEdge records that the template From includes or calls the template To.
+type GraphEdge struct {
+  From string `json:"from"`
+  To string `json:"to"`
+  Kind string `json:"kind"`
+}
+
+// DependencyGraph holds the dependencies between templates.
+// Nodes are sorted by name, and edges by from and to.
+type DependencyGraph struct {
+  Nodes []*GraphNode `json:"nodes"`
+  Edges []*GraphEdge `json:"edges"`
+}
+
+// DependencyGraph parses all of the templates in the refpaths, using the
+// functions available to this generator, and returns the dependencies
+// between them. A template that can't be parsed is included with its
+// error, but without its dependencies.
+// The error return is for problems reading the refpaths.
+func (g *Generator) DependencyGraph(refpaths []string) (*DependencyGraph, error) {
+  catalog, err := ReadCatalog(refpaths)
+  if err != nil {
+    return nil, err
+  }
+  funcs := g.checkFuncs()
+  nodes := make(map[string]*GraphNode)
+  edges := make(map[GraphEdge]bool)
+  for _, e := range catalog {
+    node := &GraphNode{Name: e.Name, Path: e.Path}
+    nodes[e.Name] = node
+    trees, err := parseTemplateFile(e.Path, funcs)
+    if err != nil {
+      node.Err = err.Error()
+      continue
+    }
+    for _, tree := range trees {
+      from := e.Name
+      if tree.Name != e.Path {
+        from = e.Name + "/" + tree.Name
+        nodes[from] = &GraphNode{Name: from, Path: e.Path, File: e.Name}
+      }
+      walkNodes(tree.Root, func(n parse.Node) {
+        switch n := n.(type) {
+        case *parse.TemplateNode:
+          edges[GraphEdge{From: from, To: e.Name + "/" + n.Name, Kind: EdgeTemplate}] = true
+        case *parse.CommandNode:
+          args, ok := includeCall(n)
+          if !ok {
+            return
+          }
+          if s, ok := args[0].(*parse.StringNode); ok {
+            edges[GraphEdge{From: from, To: s.Text, Kind: EdgeInclude}] = true
+          } else {
+            node.Dynamic = true
+          }
+        }
+      })
+    }
+  }
+  dg := &DependencyGraph{}
+  for edge := range edges {
+    e := edge
+    if nodes[e.To] == nil {
+      nodes[e.To] = &GraphNode{Name: e.To}      // Not found.
+    }
+    dg.Edges = append(dg.Edges, &e)
+  }
+  for _, node := range nodes {
+    dg.Nodes = append(dg.Nodes, node)
+  }
+  sort.Slice(dg.Nodes, func(i, j int) bool {
+    return dg.Nodes[i].Name < dg.Nodes[j].Name
+  })
+  sort.Slice(dg.Edges, func(i, j int) bool {
+    a, b := dg.Edges[i], dg.Edges[j]
+    if a.From != b.From {
+      return a.From < b.From
+    }
+    return a.To < b.To
+  })
+  return dg, nil
+}
+
+// Node returns the node with the given name, or nil if there is none.
+func (dg *DependencyGraph) Node(name string) *GraphNode {
+  i := sort.Search(len(dg.Nodes), func(i int) bool {
+    return dg.Nodes[i].Name >= name
+  })
+  if i < len(dg.Nodes) && dg.Nodes[i].Name == name {
+    return dg.Nodes[i]
+  }
+  return nil
+}
+
+// Dependents returns the names of the template files that depend on the
+// named template, directly or indirectly, so that a change to it may change
+// their output. The result is sorted and does not include name itself.
+func (dg *DependencyGraph) Dependents(name string) []string {
+  from := make(map[string][]string)
+  for _, e := range dg.Edges {
+    from[e.To] = append(from[e.To], e.From)
+  }
+  seen := map[string]bool{name: true}
+  queue := []string{name}
+  files := make(map[string]bool)
+  for len(queue) > 0 {
+    n := queue[0]
+    queue = queue[1:]
+    for _, f := range from[n] {
+      if seen[f] {
+        continue
+      }
+      seen[f] = true
+      queue = append(queue, f)
+      if node := dg.Node(f); node != nil && node.File != "" {
+        f = node.File
+      }
+      files[f] = true
+    }
+  }
+  delete(files, name)
+  result := make([]string, 0, len(files))
+  for f := range files {
+    result = append(result, f)
+  }
+  sort.Strings(result)
+  return result
+}
+
+// WriteDOT writes the graph in the DOT language of graphviz.
+// Templates defined within a file are grouped in a cluster with the file,
+// templates that are not found are drawn dashed, and templates with a
+// dynamic include are drawn with a double border.
+func (dg *DependencyGraph) WriteDOT(w io.Writer) error {
+  var err error
+  printf := func(format string, args ...interface{}) {
+    if err == nil {
+      _, err = fmt.Fprintf(w, format, args...)
+    }
+  }
+  defined := make(map[string][]string)
+  for _, n := range dg.Nodes {
+    if n.File != "" {
+      defined[n.File] = append(defined[n.File], n.Name)
+    }
+  }
+  printf("digraph templates {\n")
+  printf("  node [shape=box];\n")
+  for _, n := range dg.Nodes {
+    if n.File != "" {
+      continue
+    }
+    if len(defined[n.Name]) > 0 {
+      printf("  subgraph %s {\n", strconv.Quote("cluster_" + n.Name))
+      printf("    %s%s;\n", strconv.Quote(n.Name), dotAttributes(n))
+      for _, d := range defined[n.Name] {
+        printf("    %s [label=%s];\n", strconv.Quote(d), strconv.Quote(strings.TrimPrefix(d, n.Name + "/")))
+      }
+      printf("  }\n")
+    } else {
+      printf("  %s%s;\n", strconv.Quote(n.Name), dotAttributes(n))
+    }
+  }
+  for _, e := range dg.Edges {
+    style := ""
+    if e.Kind == EdgeTemplate {
+      style = " [style=dotted]"
+    }
+    printf("  %s -> %s%s;\n", strconv.Quote(e.From), strconv.Quote(e.To), style)
+  }
+  printf("}\n")
+  return err
+}
+
+func dotAttributes(n *GraphNode) string {
+  switch {
+  case n.Err != "":
+    return " [color=red]"
+  case n.Path == "":
+    return " [style=dashed]"
+  case n.Dynamic:
+    return " [peripheries=2]"
+  }
+  return ""
+}
+
+// WriteJSON writes the graph as JSON.
+func (dg *DependencyGraph) WriteJSON(w io.Writer) error {
+  b, err := json.MarshalIndent(dg, "", "  ")
+  if err != nil {
+    return err
+  }
+  _, err = fmt.Fprintf(w, "%s\n", b)
+  return err
+}
@@ -0,0 +1,53 @@
+package gen
+
+import (
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+func readTestGraph(t *testing.T) *DependencyGraph {
+  t.Helper()
+  dg, err := New("graph", false, nil, nil).DependencyGraph([]string{"testdata/graph"})
+  if err != nil {
+    t.Fatalf("DependencyGraph: unexpected error: %v", err)
+  }
+  return dg
+}
+
+func TestDependencyGraphDOT(t *testing.T) {
+  dg := readTestGraph(t)
+  r := goldenbase.NewTester("graph-dot")
+  goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+  goldenbase.FatalIfError(t, dg.WriteDOT(r.OutW), "WriteDOT")
+  goldenbase.FatalIfError(t, r.Assert(), "Assert")
+}
+
+func TestDependencyGraphJSON(t *testing.T) {
+  dg := readTestGraph(t)
+  r := goldenbase.NewTester("graph-json")
+  goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+  goldenbase.FatalIfError(t, dg.WriteJSON(r.OutW), "WriteJSON")
+  goldenbase.FatalIfError(t, r.Assert(), "Assert")
+}
+
+func TestDependents(t *testing.T) {
+  dg := readTestGraph(t)
+  tests := []struct{
+    name string
+    want []string
+  }{
+    {"logo", []string{"header", "report", "summary"}},
+    {"cell", []string{"report"}},
+    {"footer", []string{"summary"}},
+    {"missing", []string{"dynamic"}},
+    {"report", []string{}},
+  }
+  for _, tt := range tests {
+    if diff := cmp.Diff(tt.want, dg.Dependents(tt.name)); diff != "" {
+      t.Errorf("Dependents(%s) (-want +got):\n%s", tt.name, diff)
+    }
+  }
+}
@@ -0,0 +1,192 @@
+package gen
+
+/* This file contains support for rendering a partial report when parts of
+ * it fail. The try and tryOr template functions let a template handle the
+ * failure of a section itself. In lenient mode, a section that fails is
+ * replaced by a visible placeholder, and the errors from all failed sections
+ * are collected and returned together at the end of the report.
+ *
+ * A section is a call to include, evalTemplate, row, rows, query or queryRow.
+ * The output of a section that includes a template is buffered, so that
+ * none of it appears in the output if it fails.
+ */
+
+import (
+  "bytes"
+  "fmt"
+  htmltemplate "html/template"
+  "io"
+  "strings"
+
+  "github.com/golang/glog"
+)
+
+// TryResult is the value returned by the try and tryOr template functions.
+type TryResult struct {
+  Value interface{}     // The value of the call, or the fallback value if it failed.
+  Err string            // The error message if the call failed, else the empty string.
+}
+
+// Failed returns true if the call failed.
+func (r *TryResult) Failed() bool {
+  return r.Err != ""
+}
+
+// RenderErrors is returned from a report run in lenient mode when one or more
+// sections of the report failed. The report has been completely rendered, with
+// placeholders where the failed sections would have been.
+type RenderErrors struct {
+  Name string
+  Errors []error
+}
+
+// Error returns a summary of all of the errors.
+func (e *RenderErrors) Error() string {
+  s := ""
+  if len(e.Errors) > 1 { s = "s" }
+  msgs := make([]string, len(e.Errors))
+  for i, err := range e.Errors {
+    msgs[i] = err.Error()
+  }
+  return fmt.Sprintf("%d error%s rendering %s: %s", len(e.Errors), s, e.Name, strings.Join(msgs, "; "))
+}
+
+// WithLenient creates a copy of a generator with lenient mode turned on or off.
+func (g *Generator) WithLenient(lenient bool) *Generator {
+  glog.V(1).Infof("gtrepgen.WithLenient(%v) from name %s", lenient, g.name)
+  gc := g.clone()
+  gc.lenient = lenient
+  return gc
+}
+
+// buffered calls f with a generator that writes to a buffer. If f succeeds,
+// the contents of the buffer are written to our output.
+func (g *Generator) buffered(f func(*Generator) (interface{}, error)) (interface{}, error) {
+  var b bytes.Buffer
+  v, err := f(g.WithWriter(&b))
+  if err != nil {
+    return nil, err
+  }
+  if _, err := b.WriteTo(g.w); err != nil {
+    return nil, err
+  }
+  return v, nil
+}
+
+// sectionFunc returns the function that implements the named section call,
+// or nil if the name is not that of a section.
+func (g *Generator) sectionFunc(fname string) func(args ...interface{}) (interface{}, error) {
+  switch fname {
+  case "include", "evalTemplate":
+    return func(args ...interface{}) (interface{}, error) {
+      if len(args) == 0 {
+        return nil, fmt.Errorf("%s requires at least one arg", fname)
+      }
+      s, ok := args[0].(string)
+      if !ok {
+        return nil, fmt.Errorf("%s first arg must be string", fname)
+      }
+      return g.buffered(func(gb *Generator) (interface{}, error) {
+        if fname == "include" {
+          return gb.include(s, args[1:]...)
+        }
+        return gb.evalTemplate(s, args[1:]...)
+      })
+    }
+  case "row":
+    return g.streamed(g.dataSource().Row)
+  case "rows":
+    return g.streamed(g.dataSource().Rows)
+  case "query":
+    return g.namedQueryFunc(fname, g.streamed(g.dataSource().Rows))
+  case "queryRow":
+    return g.namedQueryFunc(fname, g.streamed(g.dataSource().Row))
+  }
+  return nil
+}
+
+// try calls the named section function with the given args, and returns
+// a TryResult with the value or the error message.
+// For example: {{$r := try "row" "select name from company where id = ?" .}}.
+func (g *Generator) try(fname string, args ...interface{}) (*TryResult, error) {
+  return g.tryOr(nil, fname, args...)
+}
+
+// tryOr is like try, but sets the Value of the result to fallback if the call fails.
+func (g *Generator) tryOr(fallback interface{}, fname string, args ...interface{}) (*TryResult, error) {
+  f := g.sectionFunc(fname)
+  if f == nil {
+    return nil, fmt.Errorf("try: %q is not one of include, evalTemplate, row, rows, query or queryRow", fname)
+  }
+  v, err := f(args...)
+  if err != nil {
+    glog.V(1).Infof("gtrepgen.try(%s) failed: %v", fname, err)
+    g.notify(&Event{Kind: EventError, Err: err})
+    return &TryResult{Value: fallback, Err: err.Error()}, nil
+  }
+  return &TryResult{Value: v}, nil
+}
+
+// lenientCall calls the named section function. In lenient mode, if the call
+// fails, we write a placeholder to the output, record the error, and return
+// the fallback value with no error.
+func (g *Generator) lenientCall(fallback interface{}, fname string, args ...interface{}) (interface{}, error) {
+  v, err := g.notifyError(g.sectionFunc(fname)(args...))
+  if err == nil || !g.lenient {
+    return v, err
+  }
+  if fname != "include" {
+    // Errors from include already name the including template.
+    err = fmt.Errorf("%s in %s: %v", fname, g.name, err)
+  }
+  g.run.errs = append(g.run.errs, err)
+  if err := g.writePlaceholder(err); err != nil {
+    return nil, err
+  }
+  return fallback, nil
+}
+
+// writePlaceholder writes a visible indication of a failed section to our output.
+func (g *Generator) writePlaceholder(err error) error {
+  var s string
+  if g.isHTML {
+    s = `<span class="gtrepgen-error">[error: ` + htmltemplate.HTMLEscapeString(err.Error()) + `]</span>`
+  } else {
+    s = "[error: " + err.Error() + "]"
+  }
+  _, werr := io.WriteString(g.w, s)
+  return werr
+}
+
+// lenientInclude, lenientEvalTemplate, lenientRow, lenientRows, lenientQuery
+// and lenientQueryRow are the template functions for include, evalTemplate,
+// row, rows, query and queryRow.
+func (g *Generator) lenientInclude(name string, args ...interface{}) (interface{}, error) {
+  if !g.lenient {
+    return g.notifyError(g.include(name, args...))
+  }
+  return g.lenientCall("", "include", append([]interface{}{name}, args...)...)
+}
+
+func (g *Generator) lenientEvalTemplate(template string, args ...interface{}) (interface{}, error) {
+  if !g.lenient {
+    return g.notifyError(g.evalTemplate(template, args...))
+  }
+  return g.lenientCall("", "evalTemplate", append([]interface{}{template}, args...)...)
+}
+
+func (g *Generator) lenientRow(args ...interface{}) (interface{}, error) {
+  return g.lenientCall(nil, "row", args...)
+}
+
+func (g *Generator) lenientRows(args ...interface{}) (interface{}, error) {
+  return g.lenientCall(nil, "rows", args...)
+}
+
+func (g *Generator) lenientQuery(args ...interface{}) (interface{}, error) {
+  return g.lenientCall(nil, "query", args...)
+}
+
+func (g *Generator) lenientQueryRow(args ...interface{}) (interface{}, error) {
+  return g.lenientCall(nil, "queryRow", args...)
+}
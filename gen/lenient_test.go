@@ -0,0 +1,71 @@
+package gen
+
+import (
+  "fmt"
+  "strings"
+  "testing"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+// failingSource fails any query that is "fail".
+type failingSource struct{
+  TestSource
+}
+
+func (s *failingSource) Rows(args ...interface{}) (interface{}, error) {
+  if args[0] == "fail" {
+    return nil, fmt.Errorf("query failed")
+  }
+  return s.TestSource.Rows(args...)
+}
+
+func TestLenient(t *testing.T) {
+  tplname := "org.jimmc.gtrepgen.lenienttest"
+  refdirpaths := []string{"testdata"}
+
+  r := goldenbase.NewTester(tplname)
+  goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+
+  g := New(tplname, false, r.OutW, &failingSource{}).WithLenient(true)
+  err := g.FromTemplate(refdirpaths, "top")
+  renderErrs, ok := err.(*RenderErrors)
+  if !ok {
+    t.Fatalf("Expected RenderErrors, got %v", err)
+  }
+  if got, want := len(renderErrs.Errors), 3; got != want {
+    t.Errorf("Error count: got %d, want %d: %v", got, want, err)
+  }
+  if got, want := err.Error(), "3 errors rendering "+tplname+": include org.jimmc.gtrepgen.lenientfail from "+tplname+": "; !strings.HasPrefix(got, want) {
+    t.Errorf("Error summary: got %q, want prefix %q", got, want)
+  }
+
+  goldenbase.FatalIfError(t, r.Assert(), "Assert")
+}
+
+func TestNotLenient(t *testing.T) {
+  var b strings.Builder
+  g := New("org.jimmc.gtrepgen.lenienttest", false, &b, &failingSource{})
+  if err := g.FromTemplate([]string{"testdata"}, "top"); err == nil {
+    t.Fatalf("Expected error when not lenient")
+  }
+}
+
+func TestLenientHTMLPlaceholder(t *testing.T) {
+  var b strings.Builder
+  g := New("test", true, &b, &failingSource{}).WithLenient(true)
+  if err := g.FromString(`<p>{{rows "fail"}}</p>`, nil); err == nil {
+    t.Fatalf("Expected error summary")
+  }
+  if got, want := b.String(), `<p><span class="gtrepgen-error">[error: rows in test: query failed]</span></p>`; got != want {
+    t.Errorf("HTML placeholder: got %q, want %q", got, want)
+  }
+}
+
+func TestTryUnknownFunc(t *testing.T) {
+  var b strings.Builder
+  g := New("test", false, &b, &failingSource{})
+  if err := g.FromString(`{{try "mkmap" 1 2}}`, nil); err == nil {
+    t.Fatalf("Expected error for try of unsupported function")
+  }
+}
@@ -0,0 +1,116 @@
+package gen
+
+/* This file contains support for observing the progress of a report run,
+ * so that tracing, progress reporting or audit logging can be added
+ * without changing the generator. An Observer is called synchronously
+ * from the goroutine running the report, so it should be quick.
+ */
+
+import (
+  "time"
+
+  "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+// EventKind identifies the kind of an Event.
+type EventKind int
+
+const (
+  EventRenderStart EventKind = iota     // The start of a report run.
+  EventRenderEnd                        // The end of a report run, with Err set if it failed.
+  EventTemplateResolved                 // A template name was found at Path.
+  EventIncludeEnter                     // The start of an include of Name.
+  EventIncludeExit                      // The end of an include of Name, with Err set if it failed.
+  EventEvalTemplateEnter                // The start of an evalTemplate.
+  EventEvalTemplateExit                 // The end of an evalTemplate, with Err set if it failed.
+  EventDataCall                         // A call to row or rows, described by Query.
+  EventError                            // A call to include, evalTemplate, row or rows failed.
+)
+
+var eventKindNames = []string{
+  "render-start",
+  "render-end",
+  "template-resolved",
+  "include-enter",
+  "include-exit",
+  "evaltemplate-enter",
+  "evaltemplate-exit",
+  "data-call",
+  "error",
+}
+
+// String returns the name of the kind, such as include-enter.
+func (k EventKind) String() string {
+  if int(k) < 0 || int(k) >= len(eventKindNames) {
+    return "unknown"
+  }
+  return eventKindNames[k]
+}
+
+// Event describes something that happened during a report run.
+type Event struct {
+  Kind EventKind
+  Time time.Time
+  Template string        // The name of the template in which the event happened.
+  Name string            // The name of the template being resolved or included.
+  Path string            // The path of the template, for EventTemplateResolved.
+  Query *data.QueryStat  // The query, for EventDataCall.
+  Err error
+}
+
+// Observer receives the events of the report runs of a generator.
+type Observer interface {
+  Observe(e *Event)
+}
+
+// ObserverFunc is an Observer that calls a function.
+type ObserverFunc func(e *Event)
+
+// Observe calls f(e).
+func (f ObserverFunc) Observe(e *Event) {
+  f(e)
+}
+
+// Observers is an Observer that passes each event to all of its observers in order.
+type Observers []Observer
+
+// Observe passes e to each observer.
+func (obs Observers) Observe(e *Event) {
+  for _, o := range obs {
+    o.Observe(e)
+  }
+}
+
+// WithObserver creates a copy of a generator that passes the events of its
+// report runs to observer. The observer is kept by copies made with WithName,
+// WithRefpaths, WithFuncs and the other With methods, and is used by includes.
+// A nil observer turns off observing.
+func (g *Generator) WithObserver(observer Observer) *Generator {
+  glog.V(1).Infof("gtrepgen.WithObserver() from name %s", g.name)
+  gc := g.clone()
+  gc.observer = observer
+  return gc
+}
+
+// notify passes an event to our observer, if we have one.
+func (g *Generator) notify(e *Event) {
+  if g.observer == nil {
+    return
+  }
+  e.Time = g.timer()
+  if e.Template == "" {
+    e.Template = g.name
+  }
+  g.observer.Observe(e)
+}
+
+// notifyError passes an EventError to our observer if err is not nil,
+// and returns v and err.
+func (g *Generator) notifyError(v interface{}, err error) (interface{}, error) {
+  if err != nil {
+    g.notify(&Event{Kind: EventError, Err: err})
+  }
+  return v, err
+}
@@ -0,0 +1,40 @@
+package gen
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestTraceObserver(t *testing.T) {
+  trace := NewTraceObserver()
+  var kinds []string
+  counter := ObserverFunc(func(e *Event) {
+    kinds = append(kinds, e.Kind.String())
+  })
+  var out strings.Builder
+  // WithName after WithObserver checks that the observer is kept by copies.
+  g := New("x", false, &out, &failingSource{}).WithTimer(steppingClock(t)).
+      WithObserver(Observers{trace, counter}).WithName("org.jimmc.gtrepgen.tracetest")
+  if err := g.FromTemplate([]string{"testdata"}, nil); err != nil {
+    t.Fatal(err)
+  }
+
+  var b strings.Builder
+  if err := trace.WriteText(&b); err != nil {
+    t.Fatal(err)
+  }
+  want := `render org.jimmc.gtrepgen.tracetest (testdata/org.jimmc.gtrepgen.tracetest.tpl) 16ms
+  include org.jimmc.gtrepgen.statsincluded (testdata/org.jimmc.gtrepgen.statsincluded.tpl) 5ms
+    row "select c from u where x = ?" 1ms
+  evalTemplate 6ms
+    rows "fail" 1ms, error: query failed
+`
+  if got := b.String(); got != want {
+    t.Errorf("Trace: got\n%s\nwant\n%s", got, want)
+  }
+  wantKinds := "template-resolved render-start template-resolved include-enter data-call include-exit " +
+      "evaltemplate-enter data-call error evaltemplate-exit render-end"
+  if got := strings.Join(kinds, " "); got != wantKinds {
+    t.Errorf("Event kinds: got %s, want %s", got, wantKinds)
+  }
+}
@@ -0,0 +1,237 @@
+package gen
+
+/* This file contains support for parameters declared in the GT attributes
+ * of a template. The attributes must be a JSON object with a params field,
+ * for example:
+ *
+ *   {
+ *     "display": "People in a company",
+ *     "params": [
+ *       {"name": "company", "type": "string", "required": true},
+ *       {"name": "period", "type": "daterange", "default": "last month"},
+ *       {"name": "limit", "type": "int", "default": 100}
+ *     ]
+ *   }
+ *
+ * When a template that declares params is executed with a map of values
+ * as dot, such as from an include with named args, the values are checked
+ * against the declared params, defaults are filled in, and string values
+ * are converted to the declared type.
+ */
+
+import (
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// The types that can be used for a Param.
+const (
+  ParamTypeString = "string"
+  ParamTypeInt = "int"
+  ParamTypeFloat = "float"
+  ParamTypeBool = "bool"
+  ParamTypeDate = "date"                // A time.Time, see ParseRelativeDate.
+  ParamTypeDateRange = "daterange"      // A *DateRange, see ParseDateRange.
+)
+
+// Param describes one parameter declared in the GT attributes of a template.
+type Param struct {
+  Name string
+  Type string           // One of the ParamType constants, default is string.
+  Required bool
+  Default interface{}
+  Display string        // A label for the param, for use in a user interface.
+  Description string
+}
+
+// paramsAttributes is used to read the params from the GT attributes of a template.
+type paramsAttributes struct {
+  Params []*Param
+}
+
+// ReadTemplateParamsFromPath reads the params declared in the GT attributes
+// of the template file at the specified path.
+func ReadTemplateParamsFromPath(tplpath string) ([]*Param, error) {
+  var attrs paramsAttributes
+  if err := ReadTemplateAttributesFromPathInto(tplpath, &attrs); err != nil {
+    return nil, err
+  }
+  if err := ValidateParams(attrs.Params); err != nil {
+    return nil, fmt.Errorf("template %s: %v", tplpath, err)
+  }
+  return attrs.Params, nil
+}
+
+// ValidateParams checks that the param declarations are valid.
+func ValidateParams(params []*Param) error {
+  seen := make(map[string]bool)
+  for _, p := range params {
+    if p.Name == "" {
+      return fmt.Errorf("param with no name")
+    }
+    if seen[p.Name] {
+      return fmt.Errorf("duplicate param %q", p.Name)
+    }
+    seen[p.Name] = true
+    switch p.Type {
+    case "", ParamTypeString, ParamTypeInt, ParamTypeFloat, ParamTypeBool, ParamTypeDate, ParamTypeDateRange:
+    default:
+      return fmt.Errorf("param %q has unknown type %q", p.Name, p.Type)
+    }
+    if p.Default != nil && p.Type != ParamTypeDate && p.Type != ParamTypeDateRange {
+      // Date defaults are relative to the report time, so we can only check them then.
+      if _, err := p.Convert(p.Default, time.Time{}); err != nil {
+        return fmt.Errorf("param %q has invalid default: %v", p.Name, err)
+      }
+    }
+  }
+  return nil
+}
+
+// Convert converts the value to the type of the param.
+// String values are parsed, and numeric values are converted between int and float.
+// Date values are parsed relative to ref.
+func (p *Param) Convert(v interface{}, ref time.Time) (interface{}, error) {
+  s, isString := v.(string)
+  switch p.Type {
+  case "", ParamTypeString:
+    if !isString {
+      return nil, fmt.Errorf("got %T, want string", v)
+    }
+    return s, nil
+  case ParamTypeInt:
+    if isString {
+      return strconv.Atoi(strings.TrimSpace(s))
+    }
+    switch n := v.(type) {
+    case int:
+      return n, nil
+    case int64:
+      return int(n), nil
+    case float64:
+      if n != float64(int(n)) {
+        return nil, fmt.Errorf("got %v, want int", n)
+      }
+      return int(n), nil
+    }
+  case ParamTypeFloat:
+    if isString {
+      return strconv.ParseFloat(strings.TrimSpace(s), 64)
+    }
+    switch n := v.(type) {
+    case int:
+      return float64(n), nil
+    case int64:
+      return float64(n), nil
+    case float64:
+      return n, nil
+    }
+  case ParamTypeBool:
+    if isString {
+      return strconv.ParseBool(strings.TrimSpace(s))
+    }
+    if b, ok := v.(bool); ok {
+      return b, nil
+    }
+  case ParamTypeDate:
+    if isString {
+      return ParseRelativeDate(s, ref)
+    }
+    if t, ok := v.(time.Time); ok {
+      return t, nil
+    }
+  case ParamTypeDateRange:
+    if isString {
+      return ParseDateRange(s, ref)
+    }
+    switch r := v.(type) {
+    case *DateRange:
+      return r, nil
+    case DateRange:
+      return &r, nil
+    }
+  }
+  return nil, fmt.Errorf("got %T, want %s", v, p.Type)
+}
+
+// ApplyParams checks the values against the declared params and returns
+// a new map with the converted values and with defaults filled in.
+// It is an error to supply a value for a param that is not declared,
+// or to omit a value for a required param.
+func ApplyParams(params []*Param, values map[string]interface{}, ref time.Time) (map[string]interface{}, error) {
+  declared := make(map[string]*Param, len(params))
+  for _, p := range params {
+    declared[p.Name] = p
+  }
+  unknown := []string{}
+  for k := range values {
+    if declared[k] == nil {
+      unknown = append(unknown, k)
+    }
+  }
+  if len(unknown) > 0 {
+    sort.Strings(unknown)
+    return nil, fmt.Errorf("unknown param %s", strings.Join(unknown, ", "))
+  }
+  result := make(map[string]interface{}, len(params))
+  for _, p := range params {
+    v, ok := values[p.Name]
+    if !ok {
+      if p.Required {
+        return nil, fmt.Errorf("missing required param %s", p.Name)
+      }
+      if p.Default == nil {
+        continue
+      }
+      v = p.Default
+    }
+    cv, err := p.Convert(v, ref)
+    if err != nil {
+      return nil, fmt.Errorf("param %s: %v", p.Name, err)
+    }
+    result[p.Name] = cv
+  }
+  return result, nil
+}
+
+// applyParams applies the declared params to dot if dot is nil or a map of named values.
+// Any other value of dot is passed through unchanged.
+func (g *Generator) applyParams(params []*Param, dot interface{}) (interface{}, error) {
+  if len(params) == 0 {
+    return dot, nil
+  }
+  var values map[string]interface{}
+  switch v := dot.(type) {
+  case nil:
+  case map[string]interface{}:
+    values = v
+  default:
+    return dot, nil
+  }
+  if err := ValidateParams(params); err != nil {
+    return nil, err
+  }
+  return ApplyParams(params, values, g.reportStartTime())
+}
+
+// namedArgs creates a map from pairs of names and values.
+func namedArgs(args []interface{}) (map[string]interface{}, error) {
+  if len(args)%2 != 0 {
+    return nil, fmt.Errorf("named args must be in name/value pairs (count=%d)", len(args))
+  }
+  m := make(map[string]interface{}, len(args)/2)
+  for k := 0; k < len(args); k += 2 {
+    name, ok := args[k].(string)
+    if !ok {
+      return nil, fmt.Errorf("arg name must be a string, got %T", args[k])
+    }
+    if _, dup := m[name]; dup {
+      return nil, fmt.Errorf("duplicate arg %s", name)
+    }
+    m[name] = args[k+1]
+  }
+  return m, nil
+}
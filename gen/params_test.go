@@ -0,0 +1,83 @@
+package gen
+
+import (
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/jimmc/gtrepgen/data"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+func TestIncludeNamedArgs(t *testing.T) {
+  tplname := "calls"
+  refdirpaths := []string{"testdata/params"}
+  clock := func() time.Time {
+    return time.Date(2019, time.February, 14, 10, 30, 0, 0, time.UTC)
+  }
+
+  r := goldenbase.NewTester(tplname)
+  r.BaseDir = "testdata/params"
+  goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+
+  g := New(tplname, false, r.OutW, &data.EmptySource{}).WithClock(clock)
+  if err := g.FromTemplate(refdirpaths, nil); err != nil {
+    t.Fatal(err)
+  }
+
+  goldenbase.FatalIfError(t, r.Assert(), "Assert")
+}
+
+func TestIncludeNamedArgsErrors(t *testing.T) {
+  tests := []struct{
+    templ string
+    want string
+  }{
+    {`{{include "company"}}`, "include company from test: template company: missing required param id"},
+    {`{{include "company" "id" "x" "lmit" 5}}`, "include company from test: template company: unknown param lmit"},
+    {`{{include "company" "id" "x" "limit" "many"}}`, "include company from test: template company: param limit: "},
+    {`{{include "company" "id" 123}}`, "include company from test: template company: param id: got int, want string"},
+    {`{{include "company" "id" "x" "limit"}}`, "include company from test: named args must be in name/value pairs"},
+    {`{{include "company" 1 2}}`, "include company from test: arg name must be a string"},
+  }
+  for _, tt := range tests {
+    var b strings.Builder
+    g := New("test", false, &b, &data.EmptySource{}).WithRefpaths([]string{"testdata/params"})
+    err := g.FromString(tt.templ, nil)
+    if err == nil {
+      t.Errorf("Template %q: expected error", tt.templ)
+      continue
+    }
+    if !strings.Contains(err.Error(), tt.want) {
+      t.Errorf("Template %q: error %q should contain %q", tt.templ, err, tt.want)
+    }
+  }
+}
+
+func TestReadTemplateParamsFromPath(t *testing.T) {
+  params, err := ReadTemplateParamsFromPath("testdata/params/company.tpl")
+  if err != nil {
+    t.Fatalf("Reading params: %v", err)
+  }
+  if got, want := len(params), 4; got != want {
+    t.Fatalf("Param count: got %d, want %d", got, want)
+  }
+  if p := params[0]; p.Name != "id" || p.Type != ParamTypeString || !p.Required {
+    t.Errorf("First param: got %+v", p)
+  }
+}
+
+func TestValidateParams(t *testing.T) {
+  bad := [][]*Param{
+    {{Name: ""}},
+    {{Name: "a"}, {Name: "a"}},
+    {{Name: "a", Type: "decimal"}},
+    {{Name: "a", Type: ParamTypeInt, Default: "x"}},
+  }
+  for _, params := range bad {
+    if err := ValidateParams(params); err == nil {
+      t.Errorf("ValidateParams(%+v): expected error", params[len(params)-1])
+    }
+  }
+}
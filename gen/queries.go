@@ -0,0 +1,161 @@
+package gen
+
+/* This file contains the extraction of literal query strings from the
+ * calls to row and rows in templates, and of the named queries used by
+ * calls to query and queryRow, so that the queries can be checked against
+ * a database without running the reports.
+ */
+
+import (
+  "sort"
+  "strings"
+  "text/template/parse"
+)
+
+// QueryRef is a literal query string passed to row or rows in a template,
+// or the query named in a call to query or queryRow.
+type QueryRef struct {
+  Path string
+  Line int
+  Col int
+  Func string           // The data function, row, rows, query or queryRow.
+  Query string
+  // Name and QueryPath are the name and .sql file of the query for
+  // query and queryRow.
+  Name string
+  QueryPath string
+  // ArgCount is the number of query args passed in the call, including
+  // the value piped in when the call is not the first in its pipeline.
+  ArgCount int
+}
+
+// Diagnostic returns a Diagnostic at the location of the query.
+func (q *QueryRef) Diagnostic(severity, code, message string) *Diagnostic {
+  return &Diagnostic{
+    Path: q.Path,
+    Line: q.Line,
+    Col: q.Col,
+    Severity: severity,
+    Code: code,
+    Message: message,
+  }
+}
+
+// ExtractQueries parses all of the templates in the refpaths, using the
+// functions available to this generator, and returns the literal query
+// strings passed to row and rows, and the named queries used by query and
+// queryRow, directly or through try or tryOr, sorted by path and location.
+// Calls with a query that is not a literal string, named queries that can't
+// be found, and templates that can't be parsed, are skipped; Check reports
+// the latter two.
+// The error return is for problems reading the refpaths.
+func (g *Generator) ExtractQueries(refpaths []string) ([]*QueryRef, error) {
+  catalog, err := ReadCatalog(refpaths)
+  if err != nil {
+    return nil, err
+  }
+  funcs := g.checkFuncs()
+  var queries []*QueryRef
+  for _, e := range catalog {
+    trees, err := parseTemplateFile(e.Path, funcs)
+    if err != nil {
+      continue
+    }
+    for _, tree := range trees {
+      walkNodes(tree.Root, func(n parse.Node) {
+        pipe, ok := n.(*parse.PipeNode)
+        if !ok {
+          return
+        }
+        for i, cmd := range pipe.Cmds {
+          fname, args, ok := dataCall(cmd)
+          if !ok {
+            continue
+          }
+          s, ok := args[0].(*parse.StringNode)
+          if !ok {
+            continue
+          }
+          argCount := len(args) - 1
+          if i > 0 {
+            argCount++          // The value piped in from the previous command.
+          }
+          location, _ := tree.ErrorContext(s)
+          line, col := parseLineCol(strings.TrimPrefix(location, tree.ParseName + ":"))
+          ref := &QueryRef{
+            Path: e.Path,
+            Line: line,
+            Col: col,
+            Func: fname,
+            Query: s.Text,
+            ArgCount: argCount,
+          }
+          if fname == "query" || fname == "queryRow" {
+            q, err := FindQueryInDirs(s.Text, refpaths)
+            if err != nil {
+              continue
+            }
+            ref.Query = q.SQL
+            ref.Name = q.Name
+            ref.QueryPath = q.Path
+          }
+          queries = append(queries, ref)
+        }
+      })
+    }
+  }
+  sort.SliceStable(queries, func(i, j int) bool {
+    a, b := queries[i], queries[j]
+    if a.Path != b.Path {
+      return a.Path < b.Path
+    }
+    if a.Line != b.Line {
+      return a.Line < b.Line
+    }
+    return a.Col < b.Col
+  })
+  return queries, nil
+}
+
+// dataCall returns the name of the data function and the args following it
+// if cmd is a call to row, rows, query or queryRow, directly or through try
+// or tryOr, so that the first of the returned args is the query, or the name
+// of the query for query and queryRow. A noCache before it is skipped.
+func dataCall(cmd *parse.CommandNode) (string, []parse.Node, bool) {
+  if len(cmd.Args) == 0 {
+    return "", nil, false
+  }
+  ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+  if !ok {
+    return "", nil, false
+  }
+  fname := ident.Ident
+  args := cmd.Args[1:]
+  switch fname {
+  case "row", "rows", "query", "queryRow":
+  case "tryOr":
+    if len(args) < 1 {
+      return "", nil, false
+    }
+    args = args[1:]
+    fallthrough
+  case "try":
+    if len(args) < 1 {
+      return "", nil, false
+    }
+    s, ok := args[0].(*parse.StringNode)
+    if !ok || (s.Text != "row" && s.Text != "rows" && s.Text != "query" && s.Text != "queryRow") {
+      return "", nil, false
+    }
+    fname = s.Text
+    args = args[1:]
+  default:
+    return "", nil, false
+  }
+  if len(args) > 0 {
+    if id, ok := args[0].(*parse.IdentifierNode); ok && id.Ident == "noCache" {
+      args = args[1:]
+    }
+  }
+  return fname, args, len(args) > 0
+}
@@ -0,0 +1,262 @@
+package gen
+
+/* This file contains support for queries stored in .sql files in the
+ * reference directories, so that long queries can be kept out of the
+ * templates, where they can be syntax-highlighted and reused.
+ * A .sql file with no name markers holds one query, named by the file name.
+ * A file can instead hold several queries, each following a marker line:
+ *   -- name: company_people
+ *   select firstname, lastname from person where companyid = ?
+ * The query function runs a named query as rows does, as in
+ * {{range query "company_people" .company}}, and queryRow runs one as row does.
+ */
+
+import (
+  "fmt"
+  "io/ioutil"
+  "path"
+  "regexp"
+  "sort"
+  "strings"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+const queryExtension = ".sql"
+
+// NamedQuery is a query read from a .sql file.
+type NamedQuery struct {
+  Name string
+  Path string
+  Line int              // The line of the file on which the query starts.
+  SQL string
+}
+
+var queryNameMarker = regexp.MustCompile(`^\s*--\s*name:\s*(\S+)\s*$`)
+
+// ReadQueryFile reads the queries in a .sql file. If the file has no name
+// markers, it holds one query, named by the file name without its extension.
+// Otherwise, only comments may come before the first marker.
+func ReadQueryFile(sqlpath string) ([]*NamedQuery, error) {
+  queries, _, err := readQueryFile(sqlpath)
+  return queries, err
+}
+
+// readQueryFile reads the queries in a .sql file, and also returns true
+// if the file has name markers.
+func readQueryFile(sqlpath string) ([]*NamedQuery, bool, error) {
+  b, err := ioutil.ReadFile(sqlpath)
+  if err != nil {
+    return nil, false, fmt.Errorf("reading query file %s: %v", sqlpath, err)
+  }
+  lines := strings.Split(string(b), "\n")
+  marked := false
+  for _, line := range lines {
+    if queryNameMarker.MatchString(line) {
+      marked = true
+      break
+    }
+  }
+  if !marked {
+    q := &NamedQuery{
+      Name: strings.TrimSuffix(path.Base(sqlpath), queryExtension),
+      Path: sqlpath,
+      Line: 1,
+      SQL: queryText(lines),
+    }
+    if q.SQL == "" {
+      return nil, false, fmt.Errorf("%s: query %s is empty", sqlpath, q.Name)
+    }
+    return []*NamedQuery{q}, false, nil
+  }
+  var queries []*NamedQuery
+  start := 0
+  for i, line := range lines {
+    m := queryNameMarker.FindStringSubmatch(line)
+    if m == nil {
+      continue
+    }
+    if len(queries) == 0 {
+      if !isCommentOnly(lines[:i]) {
+        return nil, true, fmt.Errorf("%s: query text before the first name marker", sqlpath)
+      }
+    } else {
+      queries[len(queries) - 1].SQL = queryText(lines[start:i])
+    }
+    for _, q := range queries {
+      if q.Name == m[1] {
+        return nil, true, fmt.Errorf("%s:%d: query %s is already defined on line %d", sqlpath, i + 1, q.Name, q.Line)
+      }
+    }
+    queries = append(queries, &NamedQuery{Name: m[1], Path: sqlpath, Line: i + 2})
+    start = i + 1
+  }
+  queries[len(queries) - 1].SQL = queryText(lines[start:])
+  for _, q := range queries {
+    if q.SQL == "" {
+      return nil, true, fmt.Errorf("%s:%d: query %s is empty", sqlpath, q.Line - 1, q.Name)
+    }
+  }
+  return queries, true, nil
+}
+
+// queryText returns the text of a query from its lines, without surrounding
+// space or a final semicolon.
+func queryText(lines []string) string {
+  text := strings.TrimSpace(strings.Join(lines, "\n"))
+  return strings.TrimSpace(strings.TrimSuffix(text, ";"))
+}
+
+// isCommentOnly returns true if every line is blank or a -- comment.
+func isCommentOnly(lines []string) bool {
+  for _, line := range lines {
+    line = strings.TrimSpace(line)
+    if line != "" && !strings.HasPrefix(line, "--") {
+      return false
+    }
+  }
+  return true
+}
+
+// FindQueryInDirs finds the named query in the first of the directories that
+// has it, as with FindTemplateInDirs. Within a directory, the file name.sql
+// is used if it has no name markers; otherwise the query is the one with
+// that name in any of the .sql files in the directory.
+func FindQueryInDirs(name string, refpaths []string) (*NamedQuery, error) {
+  return findQueryInDirs(name, refpaths, readQueryDir)
+}
+
+// findQueryInDirs is FindQueryInDirs, getting the queries in each directory
+// from queryDir.
+func findQueryInDirs(name string, refpaths []string, queryDir func(dir string) *queryDir) (*NamedQuery, error) {
+  for _, d := range refpaths {
+    q, err := queryDir(d).find(name)
+    if err != nil || q != nil {
+      return q, err
+    }
+  }
+  return nil, fmt.Errorf("query %q not found", name)
+}
+
+// queryDir holds the queries read from the .sql files in a directory,
+// in the order of the file names.
+type queryDir struct {
+  files []*queryFile
+}
+
+// queryFile holds the result of reading a .sql file.
+type queryFile struct {
+  name string            // The file name without its extension.
+  queries []*NamedQuery
+  marked bool
+  err error
+}
+
+// readQueryDir reads all of the .sql files in the directory. A missing
+// directory has no queries, as with FindTemplateInDirs.
+func readQueryDir(dir string) *queryDir {
+  qd := &queryDir{}
+  files, err := ioutil.ReadDir(dir)
+  if err != nil {
+    return qd
+  }
+  var names []string
+  for _, fi := range files {
+    if !fi.IsDir() && strings.HasSuffix(fi.Name(), queryExtension) {
+      names = append(names, fi.Name())
+    }
+  }
+  sort.Strings(names)
+  for _, n := range names {
+    qf := &queryFile{name: strings.TrimSuffix(n, queryExtension)}
+    qf.queries, qf.marked, qf.err = readQueryFile(path.Join(dir, n))
+    qd.files = append(qd.files, qf)
+  }
+  return qd
+}
+
+// find returns the named query in the directory, or nil if it is not there.
+func (qd *queryDir) find(name string) (*NamedQuery, error) {
+  for _, qf := range qd.files {
+    if qf.name != name {
+      continue
+    }
+    if qf.err != nil {
+      return nil, qf.err
+    }
+    if !qf.marked {
+      return qf.queries[0], nil
+    }
+  }
+  var found *NamedQuery
+  for _, qf := range qd.files {
+    if qf.err != nil {
+      return nil, qf.err
+    }
+    for _, q := range qf.queries {
+      if q.Name != name || !qf.marked {
+        continue
+      }
+      if found != nil {
+        return nil, fmt.Errorf("query %q is defined in both %s and %s", name, found.Path, q.Path)
+      }
+      found = q
+    }
+  }
+  return found, nil
+}
+
+// queryDir returns the queries in the directory, reading them only once
+// in each run.
+func (r *runState) queryDir(dir string) *queryDir {
+  if qd := r.queryDirs[dir]; qd != nil {
+    return qd
+  }
+  qd := readQueryDir(dir)
+  if r.queryDirs == nil {
+    r.queryDirs = make(map[string]*queryDir)
+  }
+  r.queryDirs[dir] = qd
+  return qd
+}
+
+// FindQuery finds the named query in the reference directories.
+// During a run, the .sql files in each directory are read only once.
+func (g *Generator) FindQuery(name string) (*NamedQuery, error) {
+  queryDir := readQueryDir
+  if g.run != nil {
+    queryDir = g.run.queryDir
+  }
+  q, err := findQueryInDirs(name, g.refpaths, queryDir)
+  if err != nil {
+    return nil, err
+  }
+  if g.onRead != nil {
+    g.onRead(q.Path)
+  }
+  return q, nil
+}
+
+// namedQueryFunc returns a function that runs the named query that is its
+// first arg, after an optional noCache, with f, which is row or rows.
+func (g *Generator) namedQueryFunc(fname string, f func(args ...interface{}) (interface{}, error)) func(args ...interface{}) (interface{}, error) {
+  return func(args ...interface{}) (interface{}, error) {
+    args, noCache := data.StripNoCache(args)
+    if len(args) == 0 {
+      return nil, fmt.Errorf("%s requires a query name", fname)
+    }
+    name, ok := args[0].(string)
+    if !ok {
+      return nil, fmt.Errorf("%s first arg must be string (query name)", fname)
+    }
+    q, err := g.FindQuery(name)
+    if err != nil {
+      return nil, err
+    }
+    queryArgs := append([]interface{}{q.SQL}, args[1:]...)
+    if noCache {
+      queryArgs = append([]interface{}{data.NoCache}, queryArgs...)
+    }
+    return f(queryArgs...)
+  }
+}
@@ -0,0 +1,141 @@
+package gen
+
+import (
+  "io/ioutil"
+  "path"
+  "strings"
+  "testing"
+
+  "github.com/google/go-cmp/cmp"
+)
+
+func TestReadQueryFile(t *testing.T) {
+  queries, err := ReadQueryFile("testdata/queries/dir1/company.sql")
+  if err != nil {
+    t.Fatalf("ReadQueryFile: %v", err)
+  }
+  want := []*NamedQuery{
+    {Name: "company_people", Path: "testdata/queries/dir1/company.sql", Line: 4,
+        SQL: "select firstname, lastname\nfrom person\nwhere companyid = ?\norder by id"},
+    {Name: "company_name", Path: "testdata/queries/dir1/company.sql", Line: 10,
+        SQL: "select name from company where id = ?"},
+  }
+  if diff := cmp.Diff(want, queries); diff != "" {
+    t.Errorf("ReadQueryFile (-want +got):\n%s", diff)
+  }
+
+  queries, err = ReadQueryFile("testdata/queries/dir1/people.sql")
+  if err != nil {
+    t.Fatalf("ReadQueryFile: %v", err)
+  }
+  want = []*NamedQuery{{Name: "people", Path: "testdata/queries/dir1/people.sql", Line: 1, SQL: "select * from person"}}
+  if diff := cmp.Diff(want, queries); diff != "" {
+    t.Errorf("ReadQueryFile single (-want +got):\n%s", diff)
+  }
+
+  errTests := []struct{
+    path string
+    want string
+  }{
+    {"testdata/queries/bad/early.sql", "query text before the first name marker"},
+    {"testdata/queries/bad/empty.sql", "empty.sql:1: query nothing is empty"},
+    {"testdata/queries/bad/nosuch.sql", "reading query file"},
+  }
+  for _, tt := range errTests {
+    _, err := ReadQueryFile(tt.path)
+    if err == nil || !strings.Contains(err.Error(), tt.want) {
+      t.Errorf("ReadQueryFile(%s): got error %v, want %q", tt.path, err, tt.want)
+    }
+  }
+}
+
+func TestFindQueryInDirs(t *testing.T) {
+  refpaths := []string{"testdata/queries/dir1", "testdata/queries/dir2"}
+  tests := []struct{
+    name string
+    wantPath string
+    wantSQL string
+  }{
+    {"company_people", "testdata/queries/dir1/company.sql", "select firstname, lastname\nfrom person\nwhere companyid = ?\norder by id"},
+    // A marked query in an earlier dir comes before a file in a later one.
+    {"company_name", "testdata/queries/dir1/company.sql", "select name from company where id = ?"},
+    {"people", "testdata/queries/dir1/people.sql", "select * from person"},
+    {"extra", "testdata/queries/dir2/extra.sql", "select 'extra'"},
+  }
+  for _, tt := range tests {
+    q, err := FindQueryInDirs(tt.name, refpaths)
+    if err != nil {
+      t.Errorf("FindQueryInDirs(%s): %v", tt.name, err)
+      continue
+    }
+    if q.Path != tt.wantPath || q.SQL != tt.wantSQL {
+      t.Errorf("FindQueryInDirs(%s): got %s %q, want %s %q", tt.name, q.Path, q.SQL, tt.wantPath, tt.wantSQL)
+    }
+  }
+  if _, err := FindQueryInDirs("nosuch", refpaths); err == nil || !strings.Contains(err.Error(), `query "nosuch" not found`) {
+    t.Errorf("FindQueryInDirs(nosuch): got error %v", err)
+  }
+  _, err := FindQueryInDirs("dup", []string{"testdata/queries/bad"})
+  if err == nil || !strings.Contains(err.Error(), "defined in both") {
+    t.Errorf("FindQueryInDirs(dup): got error %v", err)
+  }
+}
+
+func TestQueryFuncs(t *testing.T) {
+  var b strings.Builder
+  var read []string
+  g := New("org.jimmc.gtrepgen.querytest", false, &b, &TestSource{}).WithOnRead(func(path string) {
+    read = append(read, path)
+  })
+  if err := g.FromTemplate([]string{"testdata/queries/dir1", "testdata/queries/dir2"}, nil); err != nil {
+    t.Fatal(err)
+  }
+  want := "Three:select name from company where id = ?\n" +
+      "Three:select firstname, lastname\nfrom person\nwhere companyid = ?\norder by id;" +
+      "Thirteen:select firstname, lastname\nfrom person\nwhere companyid = ?\norder by id;" +
+      "Twentythree:select firstname, lastname\nfrom person\nwhere companyid = ?\norder by id;\n" +
+      "3\n" +
+      "query \"nosuch\" not found\n"
+  if got := b.String(); got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+  wantRead := []string{
+    "testdata/queries/dir1/org.jimmc.gtrepgen.querytest.tpl",
+    "testdata/queries/dir1/company.sql",
+    "testdata/queries/dir1/company.sql",
+    "testdata/queries/dir1/people.sql",
+  }
+  if diff := cmp.Diff(wantRead, read); diff != "" {
+    t.Errorf("Files read (-want +got):\n%s", diff)
+  }
+}
+
+func TestQueryFilesReadOncePerRun(t *testing.T) {
+  dir := t.TempDir()
+  sqlpath := path.Join(dir, "q.sql")
+  writeQuery := func(sql string) {
+    if err := ioutil.WriteFile(sqlpath, []byte(sql), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+  writeQuery("select 'one'")
+  funcs := map[string]interface{}{
+    "rewrite": func() string {
+      writeQuery("select 'two'")
+      return ""
+    },
+  }
+  var b strings.Builder
+  g := New("queryonce", false, &b, &TestSource{}).WithRefpaths([]string{dir}).WithFuncs(funcs)
+  templ := `{{(queryRow "q").c}};{{rewrite}}{{(queryRow "q").c}};`
+  if err := g.FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  // The changed file is not read again until the next run.
+  if err := g.FromString(templ, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "Three:select 'one';Three:select 'one';Three:select 'two';Three:select 'two';"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+}
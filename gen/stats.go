@@ -0,0 +1,178 @@
+package gen
+
+/* This file contains the collection of statistics about a report run:
+ * each query made by the report, with the template that made it, and the
+ * time spent rendering each template. The statistics can be written as
+ * JSON, or appended to the output of the report.
+ */
+
+import (
+  "encoding/json"
+  "fmt"
+  htmltemplate "html/template"
+  "io"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+// QueryRecord records one query made during a report run.
+type QueryRecord struct {
+  data.QueryStat
+  Template string `json:"template"`     // The name of the template that made the query.
+}
+
+// TemplateStat records the rendering of one template during a report run.
+type TemplateStat struct {
+  Name string `json:"name"`
+  Count int `json:"count"`                // The number of times the template was rendered.
+  // Duration is the total time spent rendering the template, including
+  // the time spent in the templates it includes and in its queries.
+  Duration time.Duration `json:"duration"`
+}
+
+// RunStats holds the statistics for one report run.
+type RunStats struct {
+  Name string `json:"name"`
+  Start time.Time `json:"start"`
+  Duration time.Duration `json:"duration"`
+  Queries []*QueryRecord `json:"queries"`
+  Templates []*TemplateStat `json:"templates"` // In the order in which they were first rendered.
+}
+
+// WithRunStats creates a copy of a generator that fills in stats for each
+// report that it runs. The stats are reset at the start of each run.
+func (g *Generator) WithRunStats(stats *RunStats) *Generator {
+  glog.V(1).Infof("gtrepgen.WithRunStats() from name %s", g.name)
+  gc := g.clone()
+  gc.stats = stats
+  return gc
+}
+
+// WithStatsAppendix creates a copy of a generator that writes the stats for
+// the run at the end of the output of each report, as text or as an HTML table.
+func (g *Generator) WithStatsAppendix(appendix bool) *Generator {
+  glog.V(1).Infof("gtrepgen.WithStatsAppendix(%v) from name %s", appendix, g.name)
+  gc := g.clone()
+  gc.statsAppendix = appendix
+  return gc
+}
+
+// startStats returns the stats to use for a run, or nil if we are not collecting them.
+func (g *Generator) startStats(start time.Time) *RunStats {
+  stats := g.stats
+  if stats == nil {
+    if !g.statsAppendix {
+      return nil
+    }
+    stats = &RunStats{}
+  }
+  *stats = RunStats{
+    Name: g.name,
+    Start: start,
+    Queries: []*QueryRecord{},
+    Templates: []*TemplateStat{},
+  }
+  return stats
+}
+
+// dataSource returns the source to use for queries from the current
+// template, which is the source for the run if our source is a
+// data.RunSource, which checks the tables of each query if the template
+// declares its tables, which passes on data.NoCache only to a
+// data.CachingSource, and which records the queries if we are collecting
+// stats or have an observer.
+func (g *Generator) dataSource() data.Source {
+  source := g.source
+  var stats *RunStats
+  if g.run != nil {
+    stats = g.run.stats
+    if g.run.source != nil {
+      source = g.run.source
+    }
+  }
+  _, caching := source.(*data.CachingSource)
+  if g.tables != nil {
+    source = &tableCheckedSource{source: source, tables: g.tables}
+  }
+  if !caching {
+    source = &noCacheStrippedSource{source}
+  }
+  if stats == nil && g.observer == nil {
+    return source
+  }
+  s := data.NewInstrumentedSource(source, func(qs *data.QueryStat) {
+    if stats != nil {
+      stats.Queries = append(stats.Queries, &QueryRecord{QueryStat: *qs, Template: g.name})
+    }
+    g.notify(&Event{Kind: EventDataCall, Query: qs})
+  })
+  s.Now = g.timer
+  return s
+}
+
+// addTemplateTime adds to the time spent rendering the named template.
+func (s *RunStats) addTemplateTime(name string, d time.Duration) {
+  for _, t := range s.Templates {
+    if t.Name == name {
+      t.Count++
+      t.Duration += d
+      return
+    }
+  }
+  s.Templates = append(s.Templates, &TemplateStat{Name: name, Count: 1, Duration: d})
+}
+
+// WriteJSON writes the stats as JSON. Durations are in nanoseconds.
+func (s *RunStats) WriteJSON(w io.Writer) error {
+  b, err := json.MarshalIndent(s, "", "  ")
+  if err != nil {
+    return err
+  }
+  _, err = fmt.Fprintf(w, "%s\n", b)
+  return err
+}
+
+// writeAppendix writes the stats to w, as text or as HTML.
+func (s *RunStats) writeAppendix(w io.Writer, isHTML bool) error {
+  if isHTML {
+    return statsAppendixHTML.Execute(w, s)
+  }
+  tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+  fmt.Fprintf(tw, "\n--- Run statistics for %s: %v ---\n", s.Name, s.Duration)
+  fmt.Fprintln(tw, "TEMPLATE\tCOUNT\tDURATION")
+  for _, t := range s.Templates {
+    fmt.Fprintf(tw, "%s\t%d\t%v\n", t.Name, t.Count, t.Duration)
+  }
+  fmt.Fprintln(tw, "\nTEMPLATE\tROWS\tDURATION\tQUERY")
+  for _, q := range s.Queries {
+    query := strings.Join(strings.Fields(q.Query), " ")
+    if q.Err != "" {
+      query += " [error: " + q.Err + "]"
+    }
+    fmt.Fprintf(tw, "%s\t%d\t%v\t%s\n", q.Template, q.Rows, q.Duration, query)
+  }
+  return tw.Flush()
+}
+
+var statsAppendixHTML = htmltemplate.Must(htmltemplate.New("stats").Parse(`
+<div class="gtrepgen-stats">
+<h2>Run statistics for {{.Name}}: {{.Duration}}</h2>
+<table>
+<tr><th>Template</th><th>Count</th><th>Duration</th></tr>
+{{- range .Templates}}
+<tr><td>{{.Name}}</td><td>{{.Count}}</td><td>{{.Duration}}</td></tr>
+{{- end}}
+</table>
+<table>
+<tr><th>Template</th><th>Rows</th><th>Duration</th><th>Query</th></tr>
+{{- range .Queries}}
+<tr><td>{{.Template}}</td><td>{{.Rows}}</td><td>{{.Duration}}</td><td>{{.Query}}{{if .Err}} [error: {{.Err}}]{{end}}</td></tr>
+{{- end}}
+</table>
+</div>
+`))
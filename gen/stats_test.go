@@ -0,0 +1,87 @@
+package gen
+
+import (
+  "strings"
+  "testing"
+  "time"
+
+  goldenbase "github.com/jimmc/golden/base"
+)
+
+// steppingClock returns a clock that advances by one millisecond on each call,
+// for use as the timer of a Generator.
+func steppingClock(t *testing.T) func() time.Time {
+  t.Helper()
+  now := mustParseDate(t, "2019-02-14 10:30")
+  return func() time.Time {
+    now = now.Add(time.Millisecond)
+    return now
+  }
+}
+
+func TestRunStats(t *testing.T) {
+  tplname := "org.jimmc.gtrepgen.statstest"
+  refdirpaths := []string{"testdata"}
+
+  r := goldenbase.NewTester(tplname)
+  goldenbase.FatalIfError(t, r.Arrange(), "Arrange")
+
+  var stats RunStats
+  g := New(tplname, false, r.OutW, &TestSource{}).WithTimer(steppingClock(t)).
+      WithRunStats(&stats).WithStatsAppendix(true)
+  if err := g.FromTemplate(refdirpaths, "top"); err != nil {
+    t.Fatal(err)
+  }
+  goldenbase.FatalIfError(t, r.Assert(), "Assert")
+
+  if got, want := len(stats.Queries), 4; got != want {
+    t.Fatalf("Query count: got %d, want %d", got, want)
+  }
+  q := stats.Queries[1]
+  if got, want := q.Template, "org.jimmc.gtrepgen.statsincluded"; got != want {
+    t.Errorf("Query template: got %s, want %s", got, want)
+  }
+  if got, want := q.Args[0], 1; got != want {
+    t.Errorf("Query args: got %v, want %v", got, want)
+  }
+  if got, want := stats.Queries[0].Rows, 3; got != want {
+    t.Errorf("Query rows: got %d, want %d", got, want)
+  }
+  var b strings.Builder
+  if err := stats.WriteJSON(&b); err != nil {
+    t.Fatal(err)
+  }
+  if want := `"template": "org.jimmc.gtrepgen.statsincluded"`; !strings.Contains(b.String(), want) {
+    t.Errorf("JSON: missing %s in %s", want, b.String())
+  }
+}
+
+func TestRunStatsHTMLAppendix(t *testing.T) {
+  var b strings.Builder
+  g := New("test", true, &b, &TestSource{}).WithTimer(steppingClock(t)).WithStatsAppendix(true)
+  if err := g.FromString(`{{with row "select <x>"}}{{.a}}{{end}}`, nil); err != nil {
+    t.Fatal(err)
+  }
+  if want := "<td>test</td><td>1</td><td>1ms</td><td>select &lt;x&gt;</td>"; !strings.Contains(b.String(), want) {
+    t.Errorf("HTML appendix: missing %q in %q", want, b.String())
+  }
+}
+
+func TestRunStatsWithFixedClock(t *testing.T) {
+  // A report "as of" a fixed time still measures how long it takes.
+  asOf := mustParseDate(t, "2019-01-01 00:00")
+  var b strings.Builder
+  var stats RunStats
+  g := New("test", false, &b, &TestSource{}).WithRunStats(&stats).
+      WithClock(func() time.Time { return asOf }).WithTimer(steppingClock(t))
+  if err := g.FromString(`{{reportStartTime.Format "2006-01-02"}} {{(row "select 1").a}}`, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := b.String(), "2019-01-01 1"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+  if stats.Duration <= 0 || stats.Queries[0].Duration <= 0 || stats.Templates[0].Duration <= 0 {
+    t.Errorf("Durations should be positive: run %v, query %v, template %v",
+        stats.Duration, stats.Queries[0].Duration, stats.Templates[0].Duration)
+  }
+}
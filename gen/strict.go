@@ -0,0 +1,96 @@
+package gen
+
+/* This file contains support for strict mode. In strict mode, a missing
+ * map key is an error rather than printing "<no value>", and so is printing
+ * a nil value, such as the dot of an include that was called without an
+ * argument or a NULL column from the database.
+ *
+ * Strict mode can be set on the Generator, or in the GT attributes of a
+ * template with {"strict": true}, in which case it applies to that template
+ * and to everything it includes.
+ */
+
+import (
+  "fmt"
+  "reflect"
+  "text/template/parse"
+
+  "github.com/golang/glog"
+)
+
+// strictFuncName is the name of the function we add to the end of every
+// printing pipeline in strict mode.
+const strictFuncName = "required"
+
+// WithStrict creates a copy of a generator with strict mode turned on or off.
+func (g *Generator) WithStrict(strict bool) *Generator {
+  glog.V(1).Infof("gtrepgen.WithStrict(%v) from name %s", strict, g.name)
+  gc := g.clone()
+  gc.strict = strict
+  return gc
+}
+
+// required returns its argument, or an error if it is nil.
+// In strict mode, it is called on the value of every action that prints a value.
+func required(v interface{}) (interface{}, error) {
+  if isNil(v) {
+    return nil, fmt.Errorf("value is nil")
+  }
+  return v, nil
+}
+
+// isNil returns true if v is nil or a nil pointer, map, slice or interface.
+func isNil(v interface{}) bool {
+  if v == nil {
+    return true
+  }
+  rv := reflect.ValueOf(v)
+  switch rv.Kind() {
+  case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+    return rv.IsNil()
+  }
+  return false
+}
+
+// addStrictChecks modifies the parse tree so that every action that prints
+// a value passes that value through our required function.
+// This must be called after parsing and before executing the template.
+func addStrictChecks(tree *parse.Tree) {
+  if tree == nil || tree.Root == nil {
+    return
+  }
+  addStrictChecksToNode(tree, tree.Root)
+}
+
+func addStrictChecksToNode(tree *parse.Tree, node parse.Node) {
+  switch n := node.(type) {
+  case *parse.ListNode:
+    if n == nil {
+      return
+    }
+    for _, child := range n.Nodes {
+      addStrictChecksToNode(tree, child)
+    }
+  case *parse.ActionNode:
+    if len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) == 0 {
+      return      // Assignments don't print anything.
+    }
+    pos := n.Pipe.Cmds[len(n.Pipe.Cmds)-1].Pos
+    ident := parse.NewIdentifier(strictFuncName).SetTree(tree).SetPos(pos)
+    cmd := &parse.CommandNode{
+      NodeType: parse.NodeCommand,
+      Pos: pos,
+      Args: []parse.Node{ident},
+    }
+    n.Pipe.Cmds = append(n.Pipe.Cmds, cmd)
+  case *parse.IfNode:
+    addStrictChecksToNode(tree, n.List)
+    addStrictChecksToNode(tree, n.ElseList)
+  case *parse.RangeNode:
+    addStrictChecksToNode(tree, n.List)
+    addStrictChecksToNode(tree, n.ElseList)
+  case *parse.WithNode:
+    addStrictChecksToNode(tree, n.List)
+    addStrictChecksToNode(tree, n.ElseList)
+  }
+}
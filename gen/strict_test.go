@@ -0,0 +1,78 @@
+package gen
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/jimmc/gtrepgen/data"
+)
+
+func TestStrictMissingKey(t *testing.T) {
+  templ := "Name {{.firstname}} {{.lastnmae}}\n"
+  dot := map[string]interface{}{"firstname": "John", "lastname": "Doe"}
+
+  var b strings.Builder
+  g := New("test", false, &b, &data.EmptySource{})
+  if err := g.FromString(templ, dot); err != nil {
+    t.Fatalf("Non-strict: unexpected error: %v", err)
+  }
+  if got, want := b.String(), "Name John <no value>\n"; got != want {
+    t.Errorf("Non-strict: got %q, want %q", got, want)
+  }
+
+  b.Reset()
+  err := g.WithStrict(true).FromString(templ, dot)
+  if err == nil {
+    t.Fatalf("Strict: expected error for missing key")
+  }
+  if got, want := err.Error(), "test:1:22"; !strings.Contains(got, want) {
+    t.Errorf("Strict: error %q should contain location %q", got, want)
+  }
+}
+
+func TestStrictNilValue(t *testing.T) {
+  dot := map[string]interface{}{"a": nil, "b": "bbb"}
+  tests := []struct{
+    templ string
+    isHTML bool
+    wantErr bool
+  }{
+    {"{{.b}}", false, false},
+    {"{{.a}}", false, true},
+    {"{{.a}}", true, true},
+    {"{{$x := .a}}{{with .b}}{{.}}{{end}}", false, false},
+    {"{{if true}}{{.b}}{{.a}}{{end}}", false, true},
+    {"{{range $k, $v := .}}{{$v}}{{end}}", false, true},
+    {"{{evalTemplate \"{{.}}\"}}", false, true},
+    {"{{evalTemplate \"{{return 1}}\"}}", false, false},
+  }
+  for _, tt := range tests {
+    var b strings.Builder
+    g := New("test", tt.isHTML, &b, &data.EmptySource{}).WithStrict(true)
+    err := g.FromString(tt.templ, dot)
+    if gotErr := err != nil; gotErr != tt.wantErr {
+      t.Errorf("Template %q: got error %v, want error %v", tt.templ, err, tt.wantErr)
+    }
+  }
+}
+
+func TestStrictInclude(t *testing.T) {
+  var b strings.Builder
+  g := New("org.jimmc.gtrepgen.testinclude", false, &b, &data.EmptySource{}).WithStrict(true)
+  err := g.FromTemplate([]string{"testdata"}, "World")
+  if err == nil {
+    t.Fatalf("Expected error for include without data")
+  }
+  if got, want := err.Error(), "org.jimmc.gtrepgen.included:1:"; !strings.Contains(got, want) {
+    t.Errorf("Error %q should contain location %q", got, want)
+  }
+}
+
+func TestStrictAttribute(t *testing.T) {
+  templ := "{{/*GT: {\"strict\": true} */ -}}\nStrict {{.missing}}\n"
+  var b strings.Builder
+  g := New("test", false, &b, &data.EmptySource{})
+  if err := g.FromString(templ, map[string]interface{}{}); err == nil {
+    t.Fatalf("Expected error for missing key with strict attribute")
+  }
+}
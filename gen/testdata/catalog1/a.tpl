@@ -0,0 +1,2 @@
+{{/*GT: {"display":"Report A"} */ -}}
+A from 1
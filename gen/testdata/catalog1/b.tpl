@@ -0,0 +1 @@
+B from 1
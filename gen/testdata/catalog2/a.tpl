@@ -0,0 +1,2 @@
+{{/*GT: {"display":"Report A, hidden"} */ -}}
+A from 2
@@ -0,0 +1,2 @@
+{{/*GT: {"display": } */ -}}
+Bad attributes
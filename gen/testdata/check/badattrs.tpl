@@ -0,0 +1,2 @@
+{{/*GT: {"Params": [} */ -}}
+Bad attributes
@@ -0,0 +1 @@
+Nobody includes me.
@@ -0,0 +1,13 @@
+{{/*GT: {
+  "Display": "Checked report",
+  "Params": [
+    {"Name": "company", "Required": true},
+    {"Name": "unused"}
+  ]
+} */ -}}
+Report for {{.company}}
+{{include "helper" .}}
+{{include "sub" "x" 1 "bogus" 2}}
+{{include "missing"}}
+{{template "nodef"}}
+{{range query "nosuchquery" .x}}{{.}}{{end}}
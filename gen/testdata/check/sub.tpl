@@ -0,0 +1,2 @@
+{{/*GT: {"Params": [{"Name": "x", "Type": "int", "Required": true}, {"Name": "y", "Required": true}]} */ -}}
+x={{.x}} y={{index . "y"}}
@@ -0,0 +1,3 @@
+{{/*GT: {} */ -}}
+Line two
+{{nosuchfunc .}}
@@ -0,0 +1 @@
+Cell {{.}}
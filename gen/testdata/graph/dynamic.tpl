@@ -0,0 +1,3 @@
+{{/*GT: {} */ -}}
+{{include .name}}
+{{include "missing"}}
@@ -0,0 +1 @@
+Footer
@@ -0,0 +1 @@
+Header {{include "logo"}}
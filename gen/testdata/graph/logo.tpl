@@ -0,0 +1 @@
+LOGO
@@ -0,0 +1,4 @@
+{{/*GT: {"Display": "Report"} */ -}}
+{{include "header"}}
+{{define "row"}}{{include "cell" .}}{{end -}}
+{{range .}}{{template "row" .}}{{end}}
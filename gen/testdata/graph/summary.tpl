@@ -0,0 +1,3 @@
+{{/*GT: {"Display": "Summary"} */ -}}
+{{includeString "header"}}
+{{tryOr "none" "include" "footer"}}
@@ -0,0 +1,6 @@
+{{ $summary := includeString "org.jimmc.gtrepgen.included" "summary" -}}
+Top: {{$summary}}
+Length: {{len $summary}}
+{{ $e := evalTemplateString "<{{.}}>" "eval" -}}
+Eval: {{$e}}
+Bottom: {{$summary}}
@@ -0,0 +1 @@
+Included time {{formatTime "2006-01-02 15:04:05 MST" reportStartTime}}
@@ -0,0 +1,7 @@
+Report time {{formatTime "2006-01-02 15:04 MST" reportStartTime}}
+Month {{formatTime "Jan 2" (startOfMonth reportStartTime)}} to {{formatTime "Jan 2" (endOfMonth reportStartTime | addDays -1)}}
+{{include "org.jimmc.gtrepgen.clockincluded" -}}
+{{with dateRange "last month" -}}
+Last month {{formatTime "Jan 2" .Start}} to {{formatTime "Jan 2" .End}}, {{.}}
+{{- end}}
+Week ago {{formatTime "Jan 2" (relativeDate "-1w")}}
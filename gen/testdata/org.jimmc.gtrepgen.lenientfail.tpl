@@ -0,0 +1,2 @@
+This partial output should not appear.
+{{.nosuchfield.sub}}
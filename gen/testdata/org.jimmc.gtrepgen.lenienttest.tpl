@@ -0,0 +1,15 @@
+Start
+{{include "org.jimmc.gtrepgen.included" "ok"}}
+Bad include: {{include "org.jimmc.gtrepgen.lenientfail" .}}
+Missing include: {{include "org.jimmc.gtrepgen.nosuchtemplate"}}
+Rows: {{range rows "fail"}}{{.}}{{end}}
+Row: {{with row "x"}}{{.a}}{{end}}
+{{with try "rows" "fail" -}}
+Try failed: {{.Failed}}, {{.Err}}
+{{- end}}
+{{with tryOr "fallback" "include" "org.jimmc.gtrepgen.lenientfail" . -}}
+TryOr value: {{.Value}}
+{{- end}}
+{{with try "include" "org.jimmc.gtrepgen.included" "tried" -}}
+{{- end}}
+End
@@ -0,0 +1 @@
+{{with row "select c from u where x = ?" .}}Included {{.c}}{{end}}
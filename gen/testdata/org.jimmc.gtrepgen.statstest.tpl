@@ -0,0 +1,2 @@
+Stats test
+{{range rows "select a, b from t where c = ?" .}}{{include "org.jimmc.gtrepgen.statsincluded" .a}}{{end -}}
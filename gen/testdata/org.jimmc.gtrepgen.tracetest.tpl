@@ -0,0 +1,3 @@
+Trace test
+{{include "org.jimmc.gtrepgen.statsincluded" "x"}}
+{{evalTemplate "{{with try \"rows\" \"fail\"}}{{.Err}}{{end}}"}}
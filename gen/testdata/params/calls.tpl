@@ -0,0 +1,3 @@
+{{include "company" "id" "x" -}}
+{{include "company" "id" "s" "limit" "25" "verbose" true "period" "2019-01" -}}
+{{include "untyped" "a" 1 "b" "two" -}}
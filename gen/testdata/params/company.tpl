@@ -0,0 +1,10 @@
+{{/*GT: {
+  "display": "Company summary",
+  "params": [
+    {"name": "id", "type": "string", "required": true},
+    {"name": "limit", "type": "int", "default": 10},
+    {"name": "verbose", "type": "bool", "default": false},
+    {"name": "period", "type": "daterange", "default": "last month"}
+  ]
+} */ -}}
+Company {{.id}} limit {{.limit}} verbose {{.verbose}} period {{.period}}
@@ -0,0 +1 @@
+Untyped a={{.a}} b={{.b}}
@@ -0,0 +1,2 @@
+-- name: dup
+select 1
@@ -0,0 +1,3 @@
+select 0
+-- name: late
+select 1
@@ -0,0 +1,4 @@
+-- name: nothing
+;
+-- name: something
+select 1
@@ -0,0 +1,10 @@
+-- Queries about companies.
+
+-- name: company_people
+select firstname, lastname
+from person
+where companyid = ?
+order by id;
+
+-- name: company_name
+select name from company where id = ?
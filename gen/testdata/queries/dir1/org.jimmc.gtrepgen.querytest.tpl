@@ -0,0 +1,4 @@
+{{(queryRow "company_name" "x").c}}
+{{range query "company_people" "x"}}{{.c}};{{end}}
+{{(try "query" "people").Value | len}}
+{{(try "query" "nosuch").Err}}
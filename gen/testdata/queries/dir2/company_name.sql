@@ -0,0 +1 @@
+select name from company where id = ? and 0
@@ -0,0 +1,2 @@
+-- name: extra
+select 'extra'
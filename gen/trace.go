@@ -0,0 +1,145 @@
+package gen
+
+/* This file contains an Observer that builds a tree of the templates,
+ * includes and queries of each report run, with their times, which can
+ * be printed to see where a report spends its time or where it failed.
+ */
+
+import (
+  "fmt"
+  "io"
+  "strings"
+  "sync"
+  "time"
+)
+
+// TraceNode is one span in a trace tree: a report run, an include,
+// an evalTemplate, or a call to row or rows.
+type TraceNode struct {
+  Kind string            // render, include, evalTemplate, row or rows.
+  Name string            // The template name, or the query for row and rows.
+  Path string
+  Start time.Time
+  Duration time.Duration
+  Rows int               // For row and rows, the number of rows returned.
+  Err string
+  Children []*TraceNode
+}
+
+// TraceObserver is an Observer that builds a trace tree for each report run.
+// It is safe to use from more than one goroutine, but the trees of runs
+// that overlap in time will be mixed together.
+type TraceObserver struct {
+  mu sync.Mutex
+  roots []*TraceNode
+  stack []*TraceNode
+  resolved map[string]string    // Template name to path, for the next render.
+}
+
+// NewTraceObserver creates an empty TraceObserver.
+func NewTraceObserver() *TraceObserver {
+  return &TraceObserver{
+    resolved: make(map[string]string),
+  }
+}
+
+// Roots returns the trace trees of the report runs observed so far.
+func (t *TraceObserver) Roots() []*TraceNode {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  return t.roots
+}
+
+// Observe adds an event to the trace tree.
+func (t *TraceObserver) Observe(e *Event) {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  switch e.Kind {
+  case EventTemplateResolved:
+    t.resolved[e.Name] = e.Path
+  case EventRenderStart:
+    t.push(&TraceNode{Kind: "render", Name: e.Template, Path: t.resolved[e.Template], Start: e.Time})
+  case EventIncludeEnter:
+    t.push(&TraceNode{Kind: "include", Name: e.Name, Path: e.Path, Start: e.Time})
+  case EventEvalTemplateEnter:
+    t.push(&TraceNode{Kind: "evalTemplate", Start: e.Time})
+  case EventRenderEnd, EventIncludeExit, EventEvalTemplateExit:
+    t.pop(e)
+  case EventDataCall:
+    q := e.Query
+    t.add(&TraceNode{Kind: q.Func, Name: q.Query, Start: q.Start, Duration: q.Duration, Rows: q.Rows, Err: q.Err})
+  }
+}
+
+// add adds n as a child of the current node, or as a root if there is none.
+func (t *TraceObserver) add(n *TraceNode) {
+  if len(t.stack) == 0 {
+    t.roots = append(t.roots, n)
+    return
+  }
+  parent := t.stack[len(t.stack)-1]
+  parent.Children = append(parent.Children, n)
+}
+
+func (t *TraceObserver) push(n *TraceNode) {
+  t.add(n)
+  t.stack = append(t.stack, n)
+}
+
+func (t *TraceObserver) pop(e *Event) {
+  if len(t.stack) == 0 {
+    return
+  }
+  n := t.stack[len(t.stack)-1]
+  t.stack = t.stack[:len(t.stack)-1]
+  n.Duration = e.Time.Sub(n.Start)
+  if e.Err != nil {
+    n.Err = e.Err.Error()
+  }
+  if len(t.stack) == 0 {
+    t.resolved = make(map[string]string)
+  }
+}
+
+// WriteText writes the trace trees as indented text, one line per node.
+func (t *TraceObserver) WriteText(w io.Writer) error {
+  for _, root := range t.Roots() {
+    if err := root.writeText(w, 0); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (n *TraceNode) writeText(w io.Writer, depth int) error {
+  var b strings.Builder
+  b.WriteString(strings.Repeat("  ", depth))
+  b.WriteString(n.Kind)
+  switch n.Kind {
+  case "row", "rows":
+    fmt.Fprintf(&b, " %q", strings.Join(strings.Fields(n.Name), " "))
+  case "evalTemplate":
+  default:
+    b.WriteString(" " + n.Name)
+  }
+  if n.Path != "" {
+    fmt.Fprintf(&b, " (%s)", n.Path)
+  }
+  fmt.Fprintf(&b, " %v", n.Duration)
+  if n.Kind == "rows" && n.Err == "" {
+    fmt.Fprintf(&b, ", %d rows", n.Rows)
+  }
+  if n.Err != "" {
+    b.WriteString(", error: " + n.Err)
+  }
+  b.WriteString("\n")
+  if _, err := io.WriteString(w, b.String()); err != nil {
+    return err
+  }
+  for _, c := range n.Children {
+    if err := c.writeText(w, depth + 1); err != nil {
+      return err
+    }
+  }
+  return nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+  "bytes"
+  "fmt"
+  "html/template"
+  "net/http"
+
+  "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Reports</title></head>
+<body>
+<h1>Reports</h1>
+<ul>
+{{- range .}}
+<li><a href="{{if .Attrs.Params}}form/{{else}}report/{{end}}{{.Name}}">{{.Title}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+var formTemplate = template.Must(template.New("form").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<form action="../report/{{.Name}}" method="get">
+{{- range .Fields}}
+<p><label for="{{.Name}}">{{.Label}}</label>
+{{if eq .InputType "checkbox" -}}
+<input type="hidden" name="{{.Name}}" value="false">
+<input type="checkbox" id="{{.Name}}" name="{{.Name}}" value="true"{{if .Checked}} checked{{end}}>
+{{- else -}}
+<input type="{{.InputType}}" id="{{.Name}}" name="{{.Name}}" value="{{.Value}}"
+  {{- if .Placeholder}} placeholder="{{.Placeholder}}"{{end}}{{if .Step}} step="{{.Step}}"{{end}}{{if .Required}} required{{end}}>
+{{- end}}
+{{- with .Description}}
+<br><small>{{.}}</small>
+{{- end}}</p>
+{{- end}}
+<p><input type="submit" value="Run report"></p>
+</form>
+</body>
+</html>
+`))
+
+// form holds the data for formTemplate.
+type form struct {
+  Name string
+  Title string
+  Fields []*formField
+}
+
+// formField holds the data for one input field in a form.
+type formField struct {
+  Name string
+  Label string
+  Description string
+  InputType string
+  Value string
+  Checked bool
+  Placeholder string
+  Step string
+  Required bool
+}
+
+// newForm creates the form for the params of a report.
+func newForm(rep *report) *form {
+  f := &form{
+    Name: rep.Name,
+    Title: rep.Title(),
+  }
+  for _, p := range rep.Attrs.Params {
+    field := &formField{
+      Name: p.Name,
+      Label: p.Display,
+      Description: p.Description,
+      InputType: "text",
+      Required: p.Required,
+    }
+    if field.Label == "" {
+      field.Label = p.Name
+    }
+    if p.Default != nil {
+      field.Value = fmt.Sprint(p.Default)
+    }
+    switch p.Type {
+    case gen.ParamTypeInt:
+      field.InputType = "number"
+    case gen.ParamTypeFloat:
+      field.InputType = "number"
+      field.Step = "any"
+    case gen.ParamTypeBool:
+      field.InputType = "checkbox"
+      field.Checked = p.Default == true
+      field.Required = false    // A required checkbox would have to be checked.
+    case gen.ParamTypeDate:
+      field.Placeholder = "YYYY-MM-DD, today, -7d, ..."
+    case gen.ParamTypeDateRange:
+      field.Placeholder = "last month, -7d, YYYY-MM-DD..YYYY-MM-DD, ..."
+    }
+    f.Fields = append(f.Fields, field)
+  }
+  return f
+}
+
+// writePage executes the template into a buffer and writes it as HTML,
+// so that we can report an error if the template fails.
+func writePage(w http.ResponseWriter, tpl *template.Template, data interface{}) {
+  var b bytes.Buffer
+  if err := tpl.Execute(&b, data); err != nil {
+    glog.Errorf("server: executing %s template: %v", tpl.Name(), err)
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  w.Header().Set("Content-Type", "text/html; charset=utf-8")
+  b.WriteTo(w)
+}
@@ -0,0 +1,208 @@
+// Package server provides an http.Handler that lets users browse the reports
+// in a set of reference directories, fill in a form with the params declared
+// by a report, and view the generated report.
+//
+// A template is a report if it has GT attributes. Its "display" attribute,
+// if present, is used as its title, and its "params" attribute declares the
+// params shown in its form, see gen.Param. If its "html" attribute is true,
+// or if the Handler has IsHTML set, it is generated as HTML, else as text.
+//
+// The Handler serves these paths:
+//   /                 the list of reports
+//   /form/NAME        the form for the params of report NAME
+//   /report/NAME      report NAME, with params from the query or form values
+//
+// The links between these pages are relative, so that the Handler can be
+// served under a prefix, as with http.StripPrefix("/reports", h) for "/reports/".
+package server
+
+import (
+  "bytes"
+  "errors"
+  "fmt"
+  "net/http"
+  "strings"
+
+  "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+// Handler serves the reports in a set of reference directories.
+type Handler struct {
+  refpaths []string
+  source data.Source
+
+  // IsHTML makes all reports generate HTML, as if they had the html attribute.
+  IsHTML bool
+  // If Configure is set, it is called on the Generator for each report,
+  // and can be used to set funcs, strict mode, the timezone, etc.
+  Configure func(g *gen.Generator) *gen.Generator
+}
+
+// reportAttributes holds the GT attributes that we use.
+type reportAttributes struct {
+  Display string
+  HTML bool
+  Params []*gen.Param
+}
+
+// report holds the information about one report.
+type report struct {
+  Name string
+  Path string
+  Attrs *reportAttributes
+}
+
+// Title returns the display name of the report, or its name.
+func (r *report) Title() string {
+  if r.Attrs.Display != "" {
+    return r.Attrs.Display
+  }
+  return r.Name
+}
+
+// New creates a Handler for the reports in the refpaths that gets its data from source.
+func New(refpaths []string, source data.Source) *Handler {
+  return &Handler{
+    refpaths: refpaths,
+    source: source,
+  }
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  glog.V(1).Infof("server: %s %s", r.Method, r.URL.Path)
+  if r.Method != http.MethodGet && r.Method != http.MethodPost {
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  p := r.URL.Path
+  switch {
+  case p == "/":
+    h.serveIndex(w, r)
+  case strings.HasPrefix(p, "/form/"):
+    h.serveForm(w, r, strings.TrimPrefix(p, "/form/"))
+  case strings.HasPrefix(p, "/report/"):
+    h.serveReport(w, r, strings.TrimPrefix(p, "/report/"))
+  default:
+    http.NotFound(w, r)
+  }
+}
+
+// reports returns the list of reports from our refpaths, sorted by name.
+// Templates with no attributes or whose attributes can't be read are not reports.
+func (h *Handler) reports() ([]*report, error) {
+  catalog, err := gen.ReadCatalog(h.refpaths)
+  if err != nil {
+    return nil, err
+  }
+  reports := []*report{}
+  for _, e := range catalog {
+    if e.Err != nil || e.Attributes == nil {
+      continue
+    }
+    attrs := &reportAttributes{}
+    if err := gen.ReadTemplateAttributesFromPathInto(e.Path, attrs); err != nil {
+      glog.V(1).Infof("server: skipping template %s: %v", e.Name, err)
+      continue
+    }
+    reports = append(reports, &report{Name: e.Name, Path: e.Path, Attrs: attrs})
+  }
+  return reports, nil
+}
+
+// findReport returns the named report, or nil if there is no such report.
+func (h *Handler) findReport(name string) (*report, error) {
+  reports, err := h.reports()
+  if err != nil {
+    return nil, err
+  }
+  for _, rep := range reports {
+    if rep.Name == name {
+      return rep, nil
+    }
+  }
+  return nil, nil
+}
+
+func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
+  reports, err := h.reports()
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  writePage(w, indexTemplate, reports)
+}
+
+func (h *Handler) serveForm(w http.ResponseWriter, r *http.Request, name string) {
+  rep, err := h.findReport(name)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  if rep == nil {
+    http.NotFound(w, r)
+    return
+  }
+  if err := gen.ValidateParams(rep.Attrs.Params); err != nil {
+    http.Error(w, fmt.Sprintf("report %s: %v", name, err), http.StatusInternalServerError)
+    return
+  }
+  writePage(w, formTemplate, newForm(rep))
+}
+
+func (h *Handler) serveReport(w http.ResponseWriter, r *http.Request, name string) {
+  rep, err := h.findReport(name)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  if rep == nil {
+    http.NotFound(w, r)
+    return
+  }
+  if err := r.ParseForm(); err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  params := make(map[string]interface{})
+  for k, v := range r.Form {
+    // An unchecked checkbox submits nothing, so the form sends a hidden
+    // false before each checkbox, and a checked one follows it with true.
+    // We use the last value, so that the checkbox wins.
+    if len(v) > 0 && v[len(v) - 1] != "" {
+      // An empty form field means the param was not set.
+      params[k] = v[len(v) - 1]
+    }
+  }
+
+  isHTML := h.IsHTML || rep.Attrs.HTML
+  var b bytes.Buffer
+  g := gen.New(name, isHTML, &b, h.source)
+  if h.Configure != nil {
+    g = h.Configure(g)
+  }
+  // Check the params first, so that we can tell the user about errors in them.
+  if _, err := gen.ApplyParams(rep.Attrs.Params, params, g.Now()); err != nil {
+    http.Error(w, fmt.Sprintf("report %s: %v", name, err), http.StatusBadRequest)
+    return
+  }
+  if err := g.FromTemplate(h.refpaths, params); err != nil {
+    var renderErrs *gen.RenderErrors
+    if !errors.As(err, &renderErrs) {
+      glog.Errorf("server: report %s: %v", name, err)
+      http.Error(w, fmt.Sprintf("report %s: %v", name, err), http.StatusInternalServerError)
+      return
+    }
+    // In lenient mode, we still have a report to show.
+    glog.Warningf("server: report %s: %v", name, err)
+  }
+  if isHTML {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+  } else {
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+  }
+  b.WriteTo(w)
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+  "database/sql"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "regexp"
+  "strings"
+  "testing"
+
+  "github.com/jimmc/gtrepgen/dbsource"
+
+  goldendb "github.com/jimmc/golden/db"
+  goldenhttp "github.com/jimmc/golden/http"
+)
+
+func newTestHandler(t *testing.T) *Handler {
+  t.Helper()
+  db, err := goldendb.DbWithSetupFile("../dbsource/testdata/dbsourcetest.sql")
+  if err != nil {
+    t.Fatalf("Creating database: %v", err)
+  }
+  t.Cleanup(func() { db.Close() })
+  return New([]string{"testdata"}, dbsource.New(db))
+}
+
+func TestServer(t *testing.T) {
+  h := newTestHandler(t)
+  tests := []struct{
+    basename string
+    url string
+    contentType string
+  }{
+    {"index", "/", "text/html; charset=utf-8"},
+    {"form", "/form/company", "text/html; charset=utf-8"},
+    {"report", "/report/company?company=s&limit=2&lastfirst=true&period=", "text/plain; charset=utf-8"},
+    {"report-html", "/report/companies", "text/html; charset=utf-8"},
+  }
+  for _, tt := range tests {
+    var contentType string
+    r := goldenhttp.NewTester(func(r *goldenhttp.Tester) http.Handler {
+      return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        h.ServeHTTP(w, req)
+        contentType = w.Header().Get("Content-Type")
+      })
+    })
+    callback := func() (*http.Request, error) {
+      return http.NewRequest("GET", tt.url, nil)
+    }
+    if err := goldenhttp.RunOneWith(r, tt.basename, callback); err != nil {
+      t.Fatalf("%s: %v", tt.basename, err)
+    }
+    if got, want := contentType, tt.contentType; got != want {
+      t.Errorf("%s: Content-Type got %q, want %q", tt.basename, got, want)
+    }
+  }
+}
+
+func TestServerErrors(t *testing.T) {
+  h := newTestHandler(t)
+  tests := []struct{
+    method string
+    url string
+    wantCode int
+    wantBody string
+  }{
+    {"GET", "/nosuchpath", http.StatusNotFound, ""},
+    {"GET", "/form/nosuch", http.StatusNotFound, ""},
+    {"GET", "/report/personname", http.StatusNotFound, ""},       // Not a report, no attributes.
+    {"GET", "/report/company", http.StatusBadRequest, "missing required param company"},
+    {"GET", "/report/company?company=x&limit=lots", http.StatusBadRequest, "param limit"},
+    {"GET", "/report/company?company=x&color=red", http.StatusBadRequest, "unknown param color"},
+    {"DELETE", "/report/company", http.StatusMethodNotAllowed, ""},
+  }
+  for _, tt := range tests {
+    req := httptest.NewRequest(tt.method, tt.url, nil)
+    rr := httptest.NewRecorder()
+    h.ServeHTTP(rr, req)
+    if got, want := rr.Code, tt.wantCode; got != want {
+      t.Errorf("%s %s: status got %d, want %d", tt.method, tt.url, got, want)
+    }
+    if got := rr.Body.String(); !strings.Contains(got, tt.wantBody) {
+      t.Errorf("%s %s: body %q should contain %q", tt.method, tt.url, got, tt.wantBody)
+    }
+  }
+}
+
+func TestServerBoolParam(t *testing.T) {
+  h := newTestHandler(t)
+  tests := []struct{
+    url string
+    want string
+  }{
+    {"/report/notify", "notify=true\n"},                              // The default.
+    {"/report/notify?notify=false", "notify=false\n"},                // Submitted with the box unchecked.
+    {"/report/notify?notify=false&notify=true", "notify=true\n"},     // Submitted with the box checked.
+  }
+  for _, tt := range tests {
+    rr := httptest.NewRecorder()
+    h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+    if got, want := rr.Code, http.StatusOK; got != want {
+      t.Errorf("%s: status got %d, want %d", tt.url, got, want)
+    }
+    if got := rr.Body.String(); got != tt.want {
+      t.Errorf("%s: got %q, want %q", tt.url, got, tt.want)
+    }
+  }
+}
+
+func TestServerUnderPrefix(t *testing.T) {
+  mux := http.NewServeMux()
+  mux.Handle("/reports/", http.StripPrefix("/reports", newTestHandler(t)))
+  get := func(u *url.URL) string {
+    t.Helper()
+    rr := httptest.NewRecorder()
+    mux.ServeHTTP(rr, httptest.NewRequest("GET", u.String(), nil))
+    if got, want := rr.Code, http.StatusOK; got != want {
+      t.Fatalf("%s: status got %d, want %d", u, got, want)
+    }
+    return rr.Body.String()
+  }
+  // Follow the links from the index to the form, and from the form to the report.
+  index, _ := url.Parse("/reports/")
+  m := regexp.MustCompile(`href="([^"]*company)"`).FindStringSubmatch(get(index))
+  if m == nil {
+    t.Fatalf("No link to the company form in the index")
+  }
+  formURL := index.ResolveReference(&url.URL{Path: m[1]})
+  if got, want := formURL.Path, "/reports/form/company"; got != want {
+    t.Errorf("Form link got %q, want %q", got, want)
+  }
+  m = regexp.MustCompile(`action="([^"]*)"`).FindStringSubmatch(get(formURL))
+  if m == nil {
+    t.Fatalf("No action in the form")
+  }
+  reportURL := formURL.ResolveReference(&url.URL{Path: m[1], RawQuery: "company=s&limit=2"})
+  if got, want := reportURL.Path, "/reports/report/company"; got != want {
+    t.Errorf("Form action got %q, want %q", got, want)
+  }
+  get(reportURL)
+}
+
+func TestServerReportFailure(t *testing.T) {
+  db, err := sql.Open("sqlite3", ":memory:")     // An empty database with no tables.
+  if err != nil {
+    t.Fatalf("Opening database: %v", err)
+  }
+  defer db.Close()
+  h := New([]string{"testdata"}, dbsource.New(db))
+  rr := httptest.NewRecorder()
+  h.ServeHTTP(rr, httptest.NewRequest("GET", "/report/companies", nil))
+  if got, want := rr.Code, http.StatusInternalServerError; got != want {
+    t.Errorf("Status got %d, want %d", got, want)
+  }
+}
@@ -0,0 +1,6 @@
+{{/*GT: {"display": "All companies", "html": true} */ -}}
+<ul>
+{{- range rows "select id, name from company order by id"}}
+<li>{{.Col.id}}: {{.Col.name}}</li>
+{{- end}}
+</ul>
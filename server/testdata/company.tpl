@@ -0,0 +1,16 @@
+{{/*GT: {
+  "display": "People in a company",
+  "params": [
+    {"name": "company", "display": "Company ID", "type": "string", "required": true,
+     "description": "The ID of the company, such as x or s"},
+    {"name": "limit", "type": "int", "default": 10},
+    {"name": "lastfirst", "display": "Last name first", "type": "bool"},
+    {"name": "period", "type": "daterange", "default": "last month"}
+  ]
+} */ -}}
+{{with row "select name from company where id = ?" .company -}}
+Company: {{.Col.name}}
+{{end -}}
+{{range rows "select firstname, lastname from person where companyid = ? order by id limit ?" .company .limit -}}
+{{include "personname" "first" .Col.firstname "last" .Col.lastname "lastfirst" $.lastfirst}}
+{{end -}}
@@ -0,0 +1,7 @@
+{{/*GT: {
+  "display": "Notification setting",
+  "params": [
+    {"name": "notify", "type": "bool", "default": true}
+  ]
+} */ -}}
+notify={{.notify}}
@@ -0,0 +1 @@
+{{if .lastfirst}}  {{.last}}, {{.first}}{{else}}  {{.first}} {{.last}}{{end -}}
@@ -0,0 +1,80 @@
+package watch
+
+import (
+  "context"
+  "fmt"
+  "html"
+  "net/http"
+  "strconv"
+  "time"
+)
+
+// liveReloadScript polls the version endpoint and reloads the page when the
+// report has been re-rendered. It uses long polling, so a reload happens
+// as soon as the render is done.
+const liveReloadScript = `
+<script>
+(function() {
+  var version = %d;
+  function poll() {
+    fetch("version?after=" + version).then(function(r) { return r.text(); }).then(function(v) {
+      if (parseInt(v, 10) > version) {
+        location.reload();
+      } else {
+        poll();
+      }
+    }, function() { setTimeout(poll, 2000); });
+  }
+  poll();
+})();
+</script>
+`
+
+// LiveReloadTimeout is the longest that a version request waits for a new render.
+var LiveReloadTimeout = 30 * time.Second
+
+// LiveReloadHandler returns an http.Handler that serves a preview of the
+// latest render of the report at "/", with a script that reloads the page
+// when the report is re-rendered. The script polls "version?after=N", which
+// waits until there is a render newer than N and returns its version.
+// If isHTML is false, the report is shown as preformatted text.
+// If the render failed, the error is shown above the partial output.
+func (w *Watcher) LiveReloadHandler(isHTML bool) http.Handler {
+  mux := http.NewServeMux()
+  mux.HandleFunc("/version", func(rw http.ResponseWriter, r *http.Request) {
+    after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+    ctx, cancel := context.WithTimeout(r.Context(), LiveReloadTimeout)
+    defer cancel()
+    version := 0
+    if result := w.WaitForVersion(ctx, after); result != nil {
+      version = result.Version
+    }
+    rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    rw.Header().Set("Cache-Control", "no-store")
+    fmt.Fprintf(rw, "%d", version)
+  })
+  mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != "/" {
+      http.NotFound(rw, r)
+      return
+    }
+    rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+    rw.Header().Set("Cache-Control", "no-store")
+    result := w.Result()
+    if result == nil {
+      fmt.Fprint(rw, "<p>Not rendered yet</p>")
+      fmt.Fprintf(rw, liveReloadScript, 0)
+      return
+    }
+    if result.Err != nil {
+      fmt.Fprintf(rw, "<pre style=\"color: red\">%s</pre>\n", html.EscapeString(result.Err.Error()))
+    }
+    if isHTML {
+      rw.Write(result.Output)
+    } else {
+      fmt.Fprintf(rw, "<pre>%s</pre>\n", html.EscapeString(string(result.Output)))
+    }
+    fmt.Fprintf(rw, liveReloadScript, result.Version)
+  })
+  return mux
+}
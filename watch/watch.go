@@ -0,0 +1,231 @@
+// Package watch re-renders a report whenever one of the files it depends on
+// changes, for use while editing templates.
+//
+// The files watched are every template file read while rendering the report,
+// including those read by include, the refpath directories themselves, so that
+// adding or removing a template is noticed, and any extra files added with
+// AddFile, such as a database file or a params file.
+// Files are polled for changes in their modification time and size.
+package watch
+
+import (
+  "bytes"
+  "context"
+  "os"
+  "sort"
+  "sync"
+  "time"
+
+  "github.com/golang/glog"
+
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+const (
+  DefaultInterval = 500 * time.Millisecond
+  DefaultDebounce = 200 * time.Millisecond
+)
+
+// Result holds the result of one rendering of the report.
+type Result struct {
+  Version int           // Incremented on each render, starting at 1.
+  Output []byte         // The output of the report, which may be partial if Err is set.
+  Err error
+  Files []string        // The files that the report depends on.
+}
+
+// Watcher renders a report and then re-renders it whenever its files change.
+type Watcher struct {
+  g *gen.Generator
+  refpaths []string
+  dot interface{}
+
+  // Interval is how often we check for changes.
+  Interval time.Duration
+  // Debounce is how long the files must be unchanged before we re-render,
+  // so that we render once when an editor saves several files.
+  Debounce time.Duration
+  // If OnResult is set, it is called after each render.
+  OnResult func(r *Result)
+
+  mu sync.Mutex
+  cond *sync.Cond
+  extraFiles []string
+  result *Result
+}
+
+// fileState is what we look at to tell if a file has changed.
+type fileState struct {
+  modTime time.Time
+  size int64
+  exists bool
+}
+
+// New creates a Watcher for the report that g generates from the refpaths with dot.
+// The writer of g is not used; the output of each render is passed in its Result.
+func New(g *gen.Generator, refpaths []string, dot interface{}) *Watcher {
+  w := &Watcher{
+    g: g,
+    refpaths: refpaths,
+    dot: dot,
+    Interval: DefaultInterval,
+    Debounce: DefaultDebounce,
+  }
+  w.cond = sync.NewCond(&w.mu)
+  return w
+}
+
+// AddFile adds a file that is not a template to the files we watch.
+func (w *Watcher) AddFile(path string) {
+  w.mu.Lock()
+  defer w.mu.Unlock()
+  w.extraFiles = append(w.extraFiles, path)
+}
+
+// Result returns the result of the most recent render, or nil if there has not been one.
+func (w *Watcher) Result() *Result {
+  w.mu.Lock()
+  defer w.mu.Unlock()
+  return w.result
+}
+
+// WaitForVersion waits until the version of the result is greater than version,
+// or until ctx is done, and returns the latest result.
+func (w *Watcher) WaitForVersion(ctx context.Context, version int) *Result {
+  done := make(chan struct{})
+  defer close(done)
+  go func() {
+    // Wake up the Wait below if ctx is done first.
+    select {
+    case <-ctx.Done():
+      w.mu.Lock()
+      defer w.mu.Unlock()
+      w.cond.Broadcast()
+    case <-done:
+    }
+  }()
+  w.mu.Lock()
+  defer w.mu.Unlock()
+  for (w.result == nil || w.result.Version <= version) && ctx.Err() == nil {
+    w.cond.Wait()
+  }
+  return w.result
+}
+
+// Run renders the report, then checks for changes and re-renders until ctx is done.
+// Errors in rendering are passed to OnResult rather than ending the run.
+func (w *Watcher) Run(ctx context.Context) error {
+  states := w.render()
+  ticker := time.NewTicker(w.Interval)
+  defer ticker.Stop()
+  for {
+    select {
+    case <-ctx.Done():
+      return ctx.Err()
+    case <-ticker.C:
+    }
+    if !changed(states, statAll(states)) {
+      continue
+    }
+    // Wait until the files stop changing.
+    glog.V(1).Infof("watch: files changed, waiting for them to settle")
+    latest := statAll(states)
+    for {
+      select {
+      case <-ctx.Done():
+        return ctx.Err()
+      case <-time.After(w.Debounce):
+      }
+      next := statAll(states)
+      if !changed(latest, next) {
+        break
+      }
+      latest = next
+    }
+    states = w.render()
+  }
+}
+
+// render renders the report, saves the result, and returns the state
+// of the files the report depends on as of when they were read.
+func (w *Watcher) render() map[string]fileState {
+  states := make(map[string]fileState)
+  for _, d := range w.refpaths {
+    states[d] = statFile(d)
+  }
+  w.mu.Lock()
+  for _, f := range w.extraFiles {
+    states[f] = statFile(f)
+  }
+  w.mu.Unlock()
+  onRead := func(tplpath string) {
+    if _, ok := states[tplpath]; !ok {
+      states[tplpath] = statFile(tplpath)
+    }
+  }
+  var b bytes.Buffer
+  err := w.g.WithWriter(&b).WithOnRead(onRead).FromTemplate(w.refpaths, w.dot)
+  if err != nil {
+    glog.Errorf("watch: %v", err)
+  }
+
+  w.mu.Lock()
+  version := 1
+  if w.result != nil {
+    version = w.result.Version + 1
+  }
+  r := &Result{
+    Version: version,
+    Output: b.Bytes(),
+    Err: err,
+    Files: sortedKeys(states),
+  }
+  w.result = r
+  w.cond.Broadcast()
+  w.mu.Unlock()
+
+  if w.OnResult != nil {
+    w.OnResult(r)
+  }
+  return states
+}
+
+// statAll returns the current state of the files in states.
+func statAll(states map[string]fileState) map[string]fileState {
+  current := make(map[string]fileState, len(states))
+  for f := range states {
+    current[f] = statFile(f)
+  }
+  return current
+}
+
+func statFile(path string) fileState {
+  fi, err := os.Stat(path)
+  if err != nil {
+    return fileState{}
+  }
+  return fileState{modTime: fi.ModTime(), size: fi.Size(), exists: true}
+}
+
+func (s fileState) same(o fileState) bool {
+  return s.exists == o.exists && s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+// changed returns true if any file is different between the two states.
+func changed(a, b map[string]fileState) bool {
+  for f, st := range a {
+    if !b[f].same(st) {
+      return true
+    }
+  }
+  return false
+}
+
+func sortedKeys(m map[string]fileState) []string {
+  keys := make([]string, 0, len(m))
+  for k := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
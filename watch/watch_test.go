@@ -0,0 +1,138 @@
+package watch
+
+import (
+  "context"
+  "io/ioutil"
+  "net/http/httptest"
+  "path"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/jimmc/gtrepgen/data"
+  "github.com/jimmc/gtrepgen/gen"
+)
+
+func writeFile(t *testing.T, fpath, content string) {
+  t.Helper()
+  if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+    t.Fatalf("Writing %s: %v", fpath, err)
+  }
+}
+
+// startWatcher creates a watcher for the top template in dir, starts it,
+// and returns it with a channel that receives each result.
+func startWatcher(t *testing.T, dir string) (*Watcher, chan *Result) {
+  t.Helper()
+  g := gen.New("top", false, nil, &data.EmptySource{})
+  w := New(g, []string{dir}, "dot")
+  w.Interval = 5 * time.Millisecond
+  w.Debounce = 5 * time.Millisecond
+  results := make(chan *Result, 10)
+  w.OnResult = func(r *Result) { results <- r }
+  ctx, cancel := context.WithCancel(context.Background())
+  done := make(chan error)
+  go func() { done <- w.Run(ctx) }()
+  t.Cleanup(func() {
+    cancel()
+    <-done
+  })
+  return w, results
+}
+
+func nextResult(t *testing.T, results chan *Result) *Result {
+  t.Helper()
+  select {
+  case r := <-results:
+    return r
+  case <-time.After(5 * time.Second):
+    t.Fatalf("Timed out waiting for render")
+  }
+  return nil
+}
+
+func TestWatch(t *testing.T) {
+  dir := t.TempDir()
+  writeFile(t, path.Join(dir, "top.tpl"), "Top {{.}}\n{{include \"part\"}}\n")
+  writeFile(t, path.Join(dir, "part.tpl"), "Part one")
+  w, results := startWatcher(t, dir)
+
+  r := nextResult(t, results)
+  if r.Err != nil {
+    t.Fatalf("First render: unexpected error: %v", r.Err)
+  }
+  if got, want := string(r.Output), "Top dot\nPart one\n"; got != want {
+    t.Errorf("First render: got %q, want %q", got, want)
+  }
+  if got, want := r.Files, []string{dir, path.Join(dir, "part.tpl"), path.Join(dir, "top.tpl")}; strings.Join(got, ",") != strings.Join(want, ",") {
+    t.Errorf("Files: got %v, want %v", got, want)
+  }
+
+  // A change to the included file causes a re-render.
+  writeFile(t, path.Join(dir, "part.tpl"), "Part number two")
+  r = nextResult(t, results)
+  if got, want := string(r.Output), "Top dot\nPart number two\n"; got != want {
+    t.Errorf("Second render: got %q, want %q", got, want)
+  }
+
+  // An error is reported, and we keep watching.
+  writeFile(t, path.Join(dir, "part.tpl"), "Part {{bad")
+  r = nextResult(t, results)
+  if r.Err == nil {
+    t.Errorf("Third render: expected error")
+  }
+  writeFile(t, path.Join(dir, "part.tpl"), "Part number three")
+  r = nextResult(t, results)
+  if r.Err != nil || r.Version != 4 {
+    t.Errorf("Fourth render: got version %d error %v", r.Version, r.Err)
+  }
+  if got := w.Result(); got != r {
+    t.Errorf("Result() got version %d, want %d", got.Version, r.Version)
+  }
+}
+
+func TestWatchMissingInclude(t *testing.T) {
+  dir := t.TempDir()
+  writeFile(t, path.Join(dir, "top.tpl"), "{{include \"part\"}}")
+  _, results := startWatcher(t, dir)
+  if r := nextResult(t, results); r.Err == nil {
+    t.Fatalf("First render: expected error for missing include")
+  }
+  // Adding the missing template changes the directory, which causes a re-render.
+  writeFile(t, path.Join(dir, "part.tpl"), "Part")
+  if r := nextResult(t, results); r.Err != nil || string(r.Output) != "Part" {
+    t.Errorf("Second render: got %q, error %v", r.Output, r.Err)
+  }
+}
+
+func TestLiveReloadHandler(t *testing.T) {
+  dir := t.TempDir()
+  writeFile(t, path.Join(dir, "top.tpl"), "Top <{{.}}>")
+  w, results := startWatcher(t, dir)
+  nextResult(t, results)
+  h := w.LiveReloadHandler(false)
+
+  rr := httptest.NewRecorder()
+  h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+  body := rr.Body.String()
+  if want := "<pre>Top &lt;dot&gt;</pre>"; !strings.Contains(body, want) {
+    t.Errorf("Preview %q should contain %q", body, want)
+  }
+  if want := "var version = 1;"; !strings.Contains(body, want) {
+    t.Errorf("Preview %q should contain %q", body, want)
+  }
+
+  rr = httptest.NewRecorder()
+  h.ServeHTTP(rr, httptest.NewRequest("GET", "/version?after=0", nil))
+  if got, want := rr.Body.String(), "1"; got != want {
+    t.Errorf("Version got %q, want %q", got, want)
+  }
+
+  // A request for a newer version waits for the next render.
+  writeFile(t, path.Join(dir, "top.tpl"), "Top again")
+  rr = httptest.NewRecorder()
+  h.ServeHTTP(rr, httptest.NewRequest("GET", "/version?after=1", nil))
+  if got, want := rr.Body.String(), "2"; got != want {
+    t.Errorf("Version after change got %q, want %q", got, want)
+  }
+}